@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   int64
+	}{
+		{"1200", 120000},
+		{"12.50", 1250},
+		{"12,50", 1250},
+		{"3,99", 399},
+		{"12.5", 1250},
+		{"0,5", 50},
+		{".99", 99},
+		{"1 200", 120000},
+		{"1 200", 120000},
+		{"1'200", 120000},
+		{"1.200", 120000},
+		{"1,200", 120000},
+		{"1.200.000", 120000000},
+		{"1 200,50", 120050},
+		{"1.200,50", 120050},
+		{"1,200.50", 120050},
+		{"12 345 678", 1234567800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := parseMinorUnits(tt.amount)
+			if err != nil {
+				t.Fatalf("parseMinorUnits(%q) error: %v", tt.amount, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseMinorUnits(%q) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMinorUnitsErrors(t *testing.T) {
+	for _, amount := range []string{"", " ", "abc", "12.345.6", "1,2345", "-5", "12..5", "1.2.3,4.5", ",", ".", "0", "0,00", "99999999999999999"} {
+		t.Run(amount, func(t *testing.T) {
+			if got, err := parseMinorUnits(amount); err == nil {
+				t.Errorf("parseMinorUnits(%q) = %d, want error", amount, got)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	date := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	cash := InitCurCash()
+	cash.m[date.Format("2006-01-02")] = map[string]Currency{
+		"EUR": {NumCode: 978, Code: "EUR", ExRate: big.NewFloat(80), Symbol: getSymbol("EUR")},
+		"USD": {NumCode: 840, Code: "USD", ExRate: big.NewFloat(75), Symbol: getSymbol("USD")},
+		"RSD": {NumCode: 941, Code: "RSD", ExRate: big.NewFloat(0.7), Symbol: getSymbol("RSD")},
+	}
+	cash.SetCurrencies([]CurrencyInfo{
+		{NumCode: 978, Code: "EUR", Aliases: []string{"€", "евро"}},
+		{NumCode: 840, Code: "USD", Aliases: []string{"$", "долл"}},
+		{NumCode: 941, Code: "RSD", Aliases: []string{"дин", "din"}},
+		{NumCode: 643, Code: "RUB", Aliases: []string{"₽", "руб"}},
+	})
+
+	tests := []struct {
+		amount string
+		want   int64
+		code   string
+	}{
+		{"500", 50000, "RUB"},
+		{"12.50€", 1250, "EUR"},
+		{"3,99$", 399, "USD"},
+		{"1 200", 120000, "RUB"},
+		{"1 200,50₽", 120050, "RUB"},
+		{"1.500€", 150000, "EUR"},
+		{"$12", 1200, "USD"},
+		{"12 usd", 1200, "USD"},
+		{"12USD", 1200, "USD"},
+		{"12eur", 1200, "EUR"},
+		{"12 евро", 1200, "EUR"},
+		{"€ 12,50", 1250, "EUR"},
+		{"1200дин", 120000, "RSD"},
+		{"1200 rsd", 120000, "RSD"},
+		{"1 200 din", 120000, "RSD"},
+		{"300 руб.", 30000, "RUB"},
+		{"120+80+45", 24500, "RUB"},
+		{"3x250€", 75000, "EUR"},
+		{"2000+10% дин", 220000, "RSD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, currency, err := parseAmount(context.Background(), tt.amount, cash, date)
+			if err != nil {
+				t.Fatalf("parseAmount(%q) error: %v", tt.amount, err)
+			}
+			if got != tt.want || currency.Code != tt.code {
+				t.Errorf("parseAmount(%q) = %d %s, want %d %s", tt.amount, got, currency.Code, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestParseAmountErrors(t *testing.T) {
+	date := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	cash := InitCurCash()
+	for _, amount := range []string{"кафе", "12 xyz", "$12€", "12$$"} {
+		t.Run(amount, func(t *testing.T) {
+			if got, _, err := parseAmount(context.Background(), amount, cash, date); err == nil {
+				t.Errorf("parseAmount(%q) = %d, want error", amount, got)
+			}
+		})
+	}
+}
+
+func TestEvalAmount(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       int64
+	}{
+		{"120+80+45", 24500},
+		{"120 + 80", 20000},
+		{"500-120", 38000},
+		{"3x250", 75000},
+		{"3х250", 75000},
+		{"3×250", 75000},
+		{"3*250", 75000},
+		{"2x12,50", 2500},
+		{"1,5x3", 450},
+		{"3x250+100", 85000},
+		{"100+3x250", 85000},
+		{"2000+10%", 220000},
+		{"2000-15%", 170000},
+		{"3x250+10%", 82500},
+		{"2000x10%", 20000},
+		{"10%x2000", 20000},
+		{"1 200+300", 150000},
+		{"9.99x3", 2997},
+		{"0,33x1,5", 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := evalAmount(tt.expression)
+			if err != nil {
+				t.Fatalf("evalAmount(%q) error: %v", tt.expression, err)
+			}
+			if got != tt.want {
+				t.Errorf("evalAmount(%q) = %d, want %d", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalAmountErrors(t *testing.T) {
+	for _, expression := range []string{"", "+", "120+", "-5", "100-200", "100-100", "3xx2", "%", "10%x10%", "1+a", "99999999999*99999999"} {
+		t.Run(expression, func(t *testing.T) {
+			if got, err := evalAmount(expression); err == nil {
+				t.Errorf("evalAmount(%q) = %d, want error", expression, got)
+			}
+		})
+	}
+}
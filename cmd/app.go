@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/rs/zerolog/log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -17,11 +20,49 @@ const (
 	ErrorParsingBill     = "Не удалось разобрать счет"
 	ErrorGettingCategory = "Не удалось получить категорию"
 	ErrorGettingCurrency = "Не удалось получить курс валюты"
+	ErrorDeletingBill    = "Не удалось удалить чек"
+	ErrorUpdatingBill    = "Не удалось обновить чек"
 	Done                 = "Готово"
+	BillDeleted          = "Чек удален"
+	BillUpdated          = "Чек обновлен"
+	BillExists           = "Этот чек уже сохранён: %s, %s %s"
+	NoBillToDelete       = "Нет чеков для удаления"
+	ReplyToDelete        = "Отправьте /del ответом на сообщение о сохраненном чеке"
+	UnknownCommand       = "Неизвестная команда, список команд: /help"
+	ErrorInternal        = "Что-то пошло не так, сообщение не обработано"
+)
+
+const UpdateTimeout = 90 * time.Second
+
+// DefaultErrorLog is the file for the messages that failed to be handled, one per line.
+const DefaultErrorLog = "errorLinks"
+
+const (
+	CommandStart  = "start"
+	CommandHelp   = "help"
+	CommandUndo   = "undo"
+	CommandDelete = "del"
+	CommandReport = "report"
+	CommandExport = "export"
+
+	CommandCategories     = "categories"
+	CommandMap            = "map"
+	CommandUnmap          = "unmap"
+	CommandRenameCategory = "rename_category"
+
+	CommandMerchant = "merchant"
+	CommandItem     = "item"
+
+	CommandInvite = "invite"
+	CommandKick   = "kick"
 )
 
 type app struct {
 	Repository *Repository
+	curCash    *CurCash
+	members    *Members
+	router     *router
+	errorLog   string
 }
 
 func (a *app) Serve(ctx context.Context) {
@@ -32,107 +73,322 @@ func (a *app) Serve(ctx context.Context) {
 	}
 	log.Info().Msgf("Authorized on account %s", bot.Self.UserName)
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
-
-	updates := bot.GetUpdatesChan(u)
-
-	curCash := InitCurCash()
-
-	for update := range updates {
-		if update.Message != nil {
-			log.Info().Msgf("[%s] %s", update.Message.From.UserName, update.Message.Text)
-
-			if strings.HasPrefix(update.Message.Text, SufPursGovRs) {
-				bill, err := a.handleLink(update.Message.Text)
-				if err != nil {
-					a.sendErrMessage(err, ErrorHandlingLink, bot, update)
-					continue
-				}
-				rsd, err := curCash.Get(bill.BoughtAt, "RSD")
-				if err != nil {
-					a.sendErrMessage(err, ErrorGettingCurrency, bot, update)
-					continue
-				}
-				usd, err := curCash.Get(bill.BoughtAt, "USD")
-				if err != nil {
-					a.sendErrMessage(err, ErrorGettingCurrency, bot, update)
-					continue
-				}
-				err = a.Repository.SaveBill(ctx, update.Message.From, bill, rsd, usd)
-				if err != nil {
-					a.sendErrMessage(err, ErrorSavingBill, bot, update)
-					continue
-				}
-				log.Info().Msg("bill saved")
-				a.sendMessage(bot, update.Message.Chat.ID, update.Message.MessageID, Done)
-			} else {
-				splitted := strings.Split(update.Message.Text, " ")
-				totalAmount, currency, err := parseAmount(splitted[0], curCash, time.Unix(int64(update.Message.Date), 0))
-				if err != nil {
-					a.sendErrMessage(err, ErrorParsingBill, bot, update)
-					continue
-				}
-
-				category, err := a.Repository.GetCategoryByDescription(ctx, splitted[1])
-				if err != nil {
-					a.sendErrMessage(err, ErrorGettingCategory, bot, update)
-					continue
-				}
-
-				bill := &Bill{
-					TotalAmount: totalAmount * 100,
-					BoughtAt:    time.Unix(int64(update.Message.Date), 0),
-					Description: splitted[1],
-					Category:    category,
-				}
-
-				usd, err := curCash.Get(bill.BoughtAt, "USD")
-				if err != nil {
-					a.sendErrMessage(err, ErrorGettingCurrency, bot, update)
-					continue
-				}
-				err = a.Repository.SaveBill(ctx, update.Message.From, bill, currency, usd)
-				if err != nil {
-					a.sendErrMessage(err, ErrorSavingBill, bot, update)
-					continue
-				}
-				log.Info().Msg("string bill saved")
-				a.sendMessage(bot, update.Message.Chat.ID, update.Message.MessageID, Done)
+	updates, stopReceiving, err := receiveUpdates(bot)
+	if err != nil {
+		log.Error().Err(err).Msg("error receiving updates")
+		panic(err)
+	}
+
+	a.curCash = InitCurCash()
+	currencies, err := a.Repository.GetCurrencies(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("error loading currencies, only default ones are known")
+	} else {
+		a.curCash.SetCurrencies(currencies)
+	}
+
+	a.members = NewMembers()
+	a.loadMembers(ctx)
+
+	workers, err := strconv.Atoi(os.Getenv("HOMEBUDGET_WORKERS"))
+	if err != nil {
+		workers = DefaultWorkers
+	}
+	a.router = a.routes()
+	a.publishCommands(bot)
+	handle := chain(a.router.Handle, withLogger, a.recoverer, withTiming, a.authorize, a.trackUser)
+	// the update context is detached from the shutdown signal in ctx, so the bills being saved when the shutdown starts get committed
+	d := newDispatcher(workers, func(update tgbotapi.Update) {
+		updateCtx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+		defer cancel()
+		handle(updateCtx, bot, update)
+	})
+	defer d.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("stopping, waiting for updates in progress")
+			// the updates received already are confirmed to telegram, they are handled before exit
+			go stopReceiving()
+			for update := range updates {
+				d.Dispatch(update)
+			}
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			d.Dispatch(update)
+		}
+	}
+}
+
+func (a *app) routes() *router {
+	r := newRouter(a.handleUnknownCommand)
+	r.Command(CommandStart, "", a.handleHelp)
+	r.Command(CommandHelp, "список команд", a.handleHelp)
+	r.Command(CommandUndo, "удалить последний сохраненный чек", a.handleUndo)
+	r.Command(CommandDelete, "удалить чек, ответом на сообщение о нем", a.handleDelete)
+	r.Command(CommandReport, "траты по категориям за месяц: /report 03.2024, /report я, /report #отпуск", a.handleReport)
+	r.Command(CommandExport, "выгрузить чеки в Excel: /export 01.01.2024 31.03.2024", a.handleExport)
+	r.Command(CommandCategories, "описания трат и их категории", a.handleCategories)
+	r.Command(CommandMap, "запомнить категорию для описания: /map такси Транспорт", a.handleMap)
+	r.Command(CommandUnmap, "забыть категорию описания: /unmap такси", a.handleUnmap)
+	r.Command(CommandRenameCategory, "переименовать категорию: /rename_category Дом -> Жилье", a.handleRenameCategory)
+	r.Command(CommandMerchant, "категория чеков магазина: /merchant 100002314 Продукты, /merchant apoteka -> Лечение", a.handleMerchant)
+	r.Command(CommandItem, "категория товаров в чеках по слову или выражению: /item пиво Алкоголь", a.handleItem)
+	r.Command(CommandInvite, "пригласить участника, для администраторов", a.handleInvite)
+	r.Command(CommandKick, "удалить участника, для администраторов: ответом на его сообщение или /kick <telegram id>", a.handleKick)
+	r.Message(isLink, a.handleLinkMessage)
+	r.Message(isMultiLine, a.handleTextBills)
+	r.Message(nil, a.handleTextBill)
+	r.EditedMessage(a.handleEditedMessage)
+	r.Callback(a.handleCallback)
+	return r
+}
+
+// publishCommands shows the registered commands in the telegram menu of the bot.
+func (a *app) publishCommands(bot *tgbotapi.BotAPI) {
+	_, err := bot.Request(tgbotapi.NewSetMyCommands(a.router.BotCommands()...))
+	if err != nil {
+		log.Error().Err(err).Msg("error publishing bot commands")
+	}
+}
+
+func isLink(message *tgbotapi.Message) bool {
+	return strings.HasPrefix(message.Text, SufPursGovRs)
+}
+
+// handleLinkMessage saves the receipt behind a link to the fiscal receipt site.
+func (a *app) handleLinkMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	bill, err := a.handleLink(ctx, message.Text)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorHandlingLink, bot, message)
+		return
+	}
+	if a.replyIfSaved(ctx, bot, message, bill) {
+		return
+	}
+	rsd, err := a.curCash.Get(ctx, bill.BoughtAt, "RSD")
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingCurrency, bot, message)
+		return
+	}
+	usd, err := a.curCash.Get(ctx, bill.BoughtAt, "USD")
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingCurrency, bot, message)
+		return
+	}
+	billId, err := a.Repository.SaveBill(ctx, message.From, message.Chat, bill, rsd, usd)
+	if errors.Is(err, ErrBillExists) && a.replyIfSaved(ctx, bot, message, bill) {
+		return
+	}
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingBill, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("bill", billId).Msg("bill saved")
+	if bill.Category == UnknownCategory {
+		a.sendCategoryPicker(ctx, bot, message, billId, 0, bill.Description)
+		return
+	}
+	a.sendDone(ctx, bot, message, billId, 0)
+}
+
+// replyIfSaved tells the user when the fiscal receipt has been saved in the chat already, it returns false if it has not.
+func (a *app) replyIfSaved(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, bill *Bill) bool {
+	if bill.InvoiceNumber == "" {
+		return false
+	}
+	saved, err := a.Repository.GetBillByInvoice(ctx, message.Chat.ID, bill.InvoiceNumber)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("error looking for a saved receipt")
+		return false
+	}
+	if saved == nil {
+		return false
+	}
+	log.Ctx(ctx).Info().Int64("bill", saved.Id).Str("invoice", bill.InvoiceNumber).Msg("receipt is already saved")
+	a.sendMessage(bot, message.Chat.ID, message.MessageID,
+		fmt.Sprintf(BillExists, saved.BoughtAt.Format("02.01.2006 15:04"), formatMoney(saved.Amount), saved.Currency))
+	return true
+}
+
+// handleTextBill saves a manual entry like "500 кафе вчера".
+func (a *app) handleTextBill(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	sentAt := time.Unix(int64(message.Date), 0)
+	bill, currency, errMsg, err := a.parseTextBill(ctx, message.Text, sentAt, sentAt)
+	if err != nil {
+		a.sendErrMessage(ctx, err, errMsg, bot, message)
+		return
+	}
+	usd, err := a.curCash.Get(ctx, bill.BoughtAt, "USD")
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingCurrency, bot, message)
+		return
+	}
+	billId, err := a.Repository.SaveBill(ctx, message.From, message.Chat, bill, currency, usd)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingBill, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("bill", billId).Msg("string bill saved")
+	if bill.Category == UnknownCategory {
+		a.sendCategoryPicker(ctx, bot, message, billId, 0, bill.Description)
+		return
+	}
+	a.sendDone(ctx, bot, message, billId, 0)
+}
+
+// handleEditedMessage recalculates the bills saved from a manual entry when the user edits it.
+func (a *app) handleEditedMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if message.IsCommand() || isLink(message) {
+		return
+	}
+	bills, err := a.Repository.GetMessageBills(ctx, message.Chat.ID, message.MessageID)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorUpdatingBill, bot, message)
+		return
+	}
+	if len(bills) == 0 {
+		return
+	}
+	billId, single := bills[0]
+	if lines, ok := editedLines(bills, message.Text); ok {
+		if single {
+			if err := a.Repository.MoveBillMessagesToLine(ctx, billId, 1); err != nil {
+				a.sendErrMessage(ctx, err, ErrorUpdatingBill, bot, message)
+				return
 			}
 		}
+		a.updateTextBills(ctx, bot, message, lines)
+		return
+	}
+
+	bill, errMsg, err := a.updateTextBill(ctx, billId, message.Text, time.Unix(int64(message.Date), 0))
+	if err != nil {
+		a.sendErrMessage(ctx, err, errMsg, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Int64("bill", billId).Msg("string bill updated")
+	if bill.Category == UnknownCategory {
+		a.sendCategoryPicker(ctx, bot, message, billId, 0, bill.Description)
+		return
+	}
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, BillUpdated)
+}
+
+// updateTextBill recalculates the saved bill from the edited text.
+// The bill keeps its original date unless the new text has one, the exchange rates are taken for that date.
+// The category is kept unless the description changed to a known one.
+func (a *app) updateTextBill(ctx context.Context, billId int64, text string, sentAt time.Time) (*Bill, string, error) {
+	saved, err := a.Repository.GetEditedBill(ctx, billId)
+	if err != nil {
+		return nil, ErrorUpdatingBill, err
+	}
+
+	bill, currency, errMsg, err := a.parseTextBill(ctx, text, sentAt, saved.BoughtAt)
+	if err != nil {
+		return nil, errMsg, err
+	}
+	// the category may have been picked for this bill only, it is not in the description mapping
+	if bill.Description == saved.Description || bill.Category == UnknownCategory {
+		bill.Category = saved.Category
+	}
+	usd, err := a.curCash.Get(ctx, bill.BoughtAt, "USD")
+	if err != nil {
+		return nil, ErrorGettingCurrency, err
+	}
+	err = a.Repository.UpdateBill(ctx, billId, bill, currency, usd)
+	if err != nil {
+		return nil, ErrorUpdatingBill, err
+	}
+	return bill, "", nil
+}
+
+// parseTextBill parses a manual entry like "500 кафе вчера". The bill is dated boughtAt unless the text has a date.
+// On failure it also returns the message for the user.
+func (a *app) parseTextBill(ctx context.Context, text string, sentAt time.Time, boughtAt time.Time) (*Bill, *Currency, string, error) {
+	entry, err := parseEntry(text, sentAt, a.curCash.Aliases())
+	if err != nil {
+		return nil, nil, ErrorParsingBill, err
+	}
+	if !entry.BoughtAt.IsZero() {
+		boughtAt = entry.BoughtAt
+	}
+	totalAmount, currency, err := parseAmount(ctx, entry.Amount, a.curCash, boughtAt)
+	if err != nil {
+		return nil, nil, ErrorParsingBill, err
 	}
+
+	category, err := a.Repository.GetCategoryByDescription(ctx, entry.Description)
+	if err != nil {
+		return nil, nil, ErrorGettingCategory, err
+	}
+
+	bill := &Bill{
+		TotalAmount: totalAmount,
+		BoughtAt:    boughtAt,
+		Description: entry.Description,
+		Category:    category,
+		Note:        entry.Note,
+		Tags:        entry.Tags,
+	}
+	if isExpression(entry.Amount) {
+		bill.Expression = entry.Amount
+	}
+	return bill, currency, "", nil
 }
 
-func (a *app) sendErrMessage(err error, errMsg string, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
-	log.Error().Err(err).Msg(errMsg)
-	a.storeMessage(update.Message.Text)
-	a.sendMessage(bot, update.Message.Chat.ID, update.Message.MessageID, errMsg)
+func (a *app) sendErrMessage(ctx context.Context, err error, errMsg string, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	log.Ctx(ctx).Error().Err(err).Msg(errMsg)
+	a.storeMessage(message.Text)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, errMsg)
 }
 
-func (a *app) sendMessage(bot *tgbotapi.BotAPI, chatID int64, messageId int, text string) {
+func (a *app) sendMessage(bot *tgbotapi.BotAPI, chatID int64, messageId int, text string) int {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ReplyToMessageID = messageId
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("error sending message")
+		return 0
+	}
+	return sent.MessageID
+}
+
+func (a *app) sendHTMLMessage(bot *tgbotapi.BotAPI, chatID int64, messageId int, text string) {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyToMessageID = messageId
+	msg.ParseMode = tgbotapi.ModeHTML
 	_, err := bot.Send(msg)
 	if err != nil {
 		log.Error().Stack().Err(err).Msg("error sending message")
 	}
 }
 
+func (a *app) sendDone(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, billId int64, line int) {
+	replyId := a.sendMessage(bot, message.Chat.ID, message.MessageID, Done)
+	a.saveBillMessages(ctx, billId, line, message, replyId)
+}
+
+func (a *app) saveBillMessages(ctx context.Context, billId int64, line int, message *tgbotapi.Message, replyId int) {
+	err := a.Repository.SaveBillMessages(ctx, billId, line, message.Chat.ID, message.MessageID, replyId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Int64("bill", billId).Msg("error saving bill messages")
+	}
+}
+
+// storeMessage appends the message to the error log if there is one.
 func (a *app) storeMessage(message string) {
-	f, err := os.OpenFile("errorLinks", os.O_APPEND|os.O_WRONLY, os.ModePerm)
+	if a.errorLog == "" {
+		return
+	}
+	f, err := os.OpenFile(a.errorLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		if os.IsNotExist(err) {
-			_, _ = os.Create("errorLinks")
-			f, err = os.OpenFile("errorLinks", os.O_APPEND|os.O_WRONLY, os.ModePerm)
-			if err != nil {
-				log.Error().Stack().Err(err).Msg("error saving message on disc")
-				return
-			}
-		} else {
-			log.Error().Stack().Err(err).Msg("error saving message on disc")
-			return
-		}
+		log.Error().Stack().Err(err).Msg("error saving message on disc")
+		return
 	}
 	defer func() { _ = f.Close() }()
 
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"strings"
+)
+
+const (
+	CallbackCategory   = "cat"
+	CallbackRemember   = "map"
+	CallbackNoRemember = "nomap"
+
+	// telegram rejects buttons with callback data longer than 64 bytes
+	maxCallbackData    = 64
+	categoryButtonsRow = 2
+)
+
+const (
+	ChooseCategory       = "Готово. Выберите категорию для «%s»"
+	RememberCategory     = "Категория «%s». Запомнить «%s» → «%s»?"
+	CategorySaved        = "Категория «%s»"
+	CategoryRemembered   = "Категория «%s». «%s» будет определяться автоматически"
+	ButtonRemember       = "Запомнить"
+	ButtonNoRemember     = "Нет"
+	ErrorSavingCategory  = "Не удалось сохранить категорию"
+	ErrorUnknownCallback = "Неизвестное действие"
+	ErrorBillNotFound    = "Расход не найден"
+)
+
+func (a *app) sendCategoryPicker(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, billId int64, line int, description string) {
+	categories, err := a.Repository.GetCategories(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg(ErrorGettingCategory)
+		a.sendDone(ctx, bot, message, billId, line)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, category := range categories {
+		data := callbackData(CallbackCategory, billId, category)
+		if len(data) > maxCallbackData {
+			continue
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(category, data))
+		if len(row) == categoryButtonsRow {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		a.sendDone(ctx, bot, message, billId, line)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf(ChooseCategory, description))
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Ctx(ctx).Error().Stack().Err(err).Msg("error sending message")
+	}
+	a.saveBillMessages(ctx, billId, line, message, sent.MessageID)
+}
+
+func (a *app) handleCallback(ctx context.Context, bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery) {
+	action, billId, value, err := parseCallbackData(query.Data)
+	if err != nil || query.Message == nil {
+		log.Ctx(ctx).Error().Err(err).Msg(ErrorUnknownCallback)
+		a.answerCallback(bot, query, ErrorUnknownCallback)
+		return
+	}
+
+	// the bill is looked up in the ledger of the chat, so a forged callback can't reach other chats' bills
+	bill, err := a.Repository.GetChatBill(ctx, query.Message.Chat.ID, billId)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Int64("bill", billId).Msg(ErrorGettingCategory)
+		a.answerCallback(bot, query, ErrorGettingCategory)
+		return
+	}
+	if bill == nil {
+		log.Ctx(ctx).Warn().Int64("bill", billId).Msg("callback for a bill not in the chat's ledger")
+		a.answerCallback(bot, query, ErrorBillNotFound)
+		return
+	}
+
+	switch action {
+	case CallbackCategory:
+		err = a.Repository.SetBillCategory(ctx, query.Message.Chat.ID, billId, value)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Int64("bill", billId).Msg(ErrorSavingCategory)
+			a.answerCallback(bot, query, ErrorSavingCategory)
+			return
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(ButtonRemember, callbackData(CallbackRemember, billId, "")),
+			tgbotapi.NewInlineKeyboardButtonData(ButtonNoRemember, callbackData(CallbackNoRemember, billId, "")),
+		))
+		a.editCallbackMessage(bot, query, fmt.Sprintf(RememberCategory, value, bill.Description, value), &keyboard)
+	case CallbackRemember:
+		pib, err := a.Repository.GetBillMerchantPib(ctx, billId)
+		if err == nil && pib != "" {
+			// the receipts of the company get the category whatever the shop
+			err = a.Repository.SaveMerchantRule(ctx, MerchantRule{Pib: pib, Category: bill.Category})
+		} else if err == nil {
+			err = a.Repository.SaveCategory(ctx, bill.Description, bill.Category)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Int64("bill", billId).Msg(ErrorSavingCategory)
+			a.answerCallback(bot, query, ErrorSavingCategory)
+			return
+		}
+		log.Ctx(ctx).Info().Msgf("category mapping saved: %s -> %s", bill.Description, bill.Category)
+		a.editCallbackMessage(bot, query, fmt.Sprintf(CategoryRemembered, bill.Category, bill.Description), nil)
+	case CallbackNoRemember:
+		a.editCallbackMessage(bot, query, fmt.Sprintf(CategorySaved, bill.Category), nil)
+	default:
+		a.answerCallback(bot, query, ErrorUnknownCallback)
+		return
+	}
+	a.answerCallback(bot, query, "")
+}
+
+func (a *app) editCallbackMessage(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	_, err := bot.Send(edit)
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("error editing message")
+	}
+}
+
+func (a *app) answerCallback(bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery, text string) {
+	_, err := bot.Request(tgbotapi.NewCallback(query.ID, text))
+	if err != nil {
+		log.Error().Stack().Err(err).Msg("error answering callback")
+	}
+}
+
+func callbackData(action string, billId int64, value string) string {
+	return fmt.Sprintf("%s:%d:%s", action, billId, value)
+}
+
+func parseCallbackData(data string) (string, int64, string, error) {
+	parts := strings.SplitN(data, ":", 3)
+	if len(parts) != 3 {
+		return "", 0, "", fmt.Errorf("unexpected callback data: %s", data)
+	}
+	billId, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", 0, "", err
+	}
+	return parts[0], billId, parts[2], nil
+}
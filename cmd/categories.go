@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"strings"
+)
+
+const (
+	UsageMap            = "Пример: /map такси Транспорт"
+	UsageUnmap          = "Пример: /unmap такси"
+	UsageRenameCategory = "Пример: /rename_category Дом и ремонт -> Дом. С флагом --history категория изменится и в сохраненных счетах"
+	NoCategories        = "Категорий пока нет"
+	CategoryMapped      = "«%s» → «%s»"
+	CategoryUnmapped    = "«%s» удалено"
+	CategoryNotFound    = "«%s» не найдено"
+	CategoryRenamed     = "«%s» → «%s»: описаний и правил %d, счетов и товаров %d"
+	ErrorGettingMapping = "Не удалось получить категории"
+	ErrorSavingMapping  = "Не удалось сохранить категорию"
+	ErrorRenaming       = "Не удалось переименовать категорию"
+
+	historyFlag = "--history"
+)
+
+var renameSeparators = []string{"->", "→", "|"}
+
+func (a *app) handleCategories(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	mappings, err := a.Repository.GetCategoryMappings(ctx)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingMapping, bot, message)
+		return
+	}
+	if len(mappings) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, NoCategories)
+		return
+	}
+
+	var sb strings.Builder
+	var descriptions []string
+	for i, mapping := range mappings {
+		descriptions = append(descriptions, mapping.Description)
+		if i == len(mappings)-1 || mappings[i+1].Category != mapping.Category {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", mapping.Category, strings.Join(descriptions, ", ")))
+			descriptions = nil
+		}
+	}
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, sb.String())
+}
+
+func (a *app) handleMap(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < 2 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageMap)
+		return
+	}
+	description := args[0]
+	category := strings.Join(args[1:], " ")
+
+	err := a.Repository.SaveCategory(ctx, description, category)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingMapping, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("category mapping saved: %s -> %s", description, category)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(CategoryMapped, description, category))
+}
+
+func (a *app) handleUnmap(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	description := strings.TrimSpace(message.CommandArguments())
+	if description == "" {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageUnmap)
+		return
+	}
+
+	deleted, err := a.Repository.DeleteCategory(ctx, description)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingMapping, bot, message)
+		return
+	}
+	if !deleted {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(CategoryNotFound, description))
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("category mapping deleted: %s", description)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(CategoryUnmapped, description))
+}
+
+func (a *app) handleRenameCategory(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	oldName, newName, withBills, ok := parseRenameArgs(message.CommandArguments())
+	if !ok {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageRenameCategory)
+		return
+	}
+
+	mappings, bills, err := a.Repository.RenameCategory(ctx, oldName, newName, withBills)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorRenaming, bot, message)
+		return
+	}
+	if mappings == 0 && bills == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(CategoryNotFound, oldName))
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("category renamed: %s -> %s", oldName, newName)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(CategoryRenamed, oldName, newName, mappings, bills))
+}
+
+// parseRenameArgs accepts "<old> -> <new>" or, for single word names, "<old> <new>".
+// The --history flag means that saved bills have to be renamed too.
+func parseRenameArgs(args string) (string, string, bool, bool) {
+	withBills := false
+	var words []string
+	for _, word := range strings.Fields(args) {
+		if word == historyFlag {
+			withBills = true
+			continue
+		}
+		words = append(words, word)
+	}
+	args = strings.Join(words, " ")
+
+	for _, separator := range renameSeparators {
+		if parts := strings.SplitN(args, separator, 2); len(parts) == 2 {
+			oldName, newName := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			return oldName, newName, withBills, oldName != "" && newName != ""
+		}
+	}
+	if len(words) == 2 {
+		return words[0], words[1], withBills, true
+	}
+	return "", "", false, false
+}
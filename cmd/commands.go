@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const HelpIntro = "Отправьте трату сообщением: «500 кафе», «12.5 EUR такси вчера #отпуск» или несколько трат, по одной в строке. " +
+	"Ссылку на фискальный чек можно отправить как есть.\n\nКоманды:"
+
+func (a *app) handleHelp(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, a.router.Help())
+}
+
+func (a *app) handleUnknownCommand(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, UnknownCommand)
+}
+
+func (a *app) handleUndo(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	billId, err := a.Repository.GetLastBillId(ctx, message.From, message.Chat.ID)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorDeletingBill, bot, message)
+		return
+	}
+	if billId == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, NoBillToDelete)
+		return
+	}
+	a.deleteBills(ctx, bot, message, billId)
+}
+
+// handleDelete deletes the bills of the replied message, all of them for a multi-line one.
+func (a *app) handleDelete(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	reply := message.ReplyToMessage
+	if reply == nil {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, ReplyToDelete)
+		return
+	}
+	bills, err := a.Repository.GetMessageBills(ctx, message.Chat.ID, reply.MessageID)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorDeletingBill, bot, message)
+		return
+	}
+	if len(bills) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, NoBillToDelete)
+		return
+	}
+	var billIds []int64
+	for _, billId := range bills {
+		billIds = append(billIds, billId)
+	}
+	a.deleteBills(ctx, bot, message, billIds...)
+}
+
+func (a *app) deleteBills(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, billIds ...int64) {
+	for _, billId := range billIds {
+		err := a.Repository.DeleteBill(ctx, billId)
+		if err != nil {
+			a.sendErrMessage(ctx, err, ErrorDeletingBill, bot, message)
+			return
+		}
+		log.Ctx(ctx).Info().Int64("bill", billId).Msg("bill deleted")
+	}
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, BillDeleted)
+}
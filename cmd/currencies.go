@@ -1,34 +1,169 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"github.com/rs/zerolog/log"
 	"io/ioutil"
+	"math"
 	"math/big"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
-func (c *Currency) getAmount(amount string) (int64, *Currency, error) {
-	amount = strings.TrimSuffix(amount, c.Symbol)
-	value, err := strconv.ParseInt(amount, 10, 64)
+// RatesLoadTimeout limits a load of rates, it goes on after the caller that started it is gone.
+const RatesLoadTimeout = 60 * time.Second
+
+var amountPattern = regexp.MustCompile(`^([^\d.,]*?)\s*([\d.,](?:[\d\s.,'’+\-×*xх%]*[\d%])?)\s*([^\d]*)$`)
+
+// defaultCurrencies are used until the currencies table is loaded.
+var defaultCurrencies = []CurrencyInfo{
+	{NumCode: 978, Code: "EUR", Title: "Евро", Aliases: []string{"€"}},
+	{NumCode: 840, Code: "USD", Title: "Доллар США", Aliases: []string{"$"}},
+	{NumCode: 941, Code: "RSD", Title: "Сербских динаров", Aliases: []string{"дин"}},
+	{NumCode: 949, Code: "TRY", Title: "Турецких лир", Aliases: []string{"tl"}},
+	{NumCode: 826, Code: "GBP", Title: "Фунт стерлингов Соединенного королевства", Aliases: []string{"£"}},
+	{NumCode: 51, Code: "AMD", Title: "Армянских драмов", Aliases: []string{"dram"}},
+	{NumCode: 643, Code: "RUB", Title: "Российский рубль", Aliases: []string{"₽"}},
+}
+
+// CurrencyAliases maps lower-cased codes, symbols and names to currency codes.
+type CurrencyAliases map[string]string
+
+func newCurrencyAliases(currencies []CurrencyInfo) CurrencyAliases {
+	aliases := CurrencyAliases{}
+	for _, currency := range currencies {
+		aliases[strings.ToLower(currency.Code)] = currency.Code
+		for _, alias := range currency.Aliases {
+			aliases[strings.ToLower(alias)] = currency.Code
+		}
+	}
+	return aliases
+}
+
+func (a CurrencyAliases) Lookup(alias string) (string, bool) {
+	code, ok := a[strings.ToLower(strings.TrimSpace(alias))]
+	return code, ok
+}
+
+// parseMinorUnits parses "1200", "12.50", "3,99", "1 200", "1.200,50" or "1,200.50" into cents.
+// A single separator followed by exactly three digits groups thousands, otherwise it separates decimals.
+func parseMinorUnits(amount string) (int64, error) {
+	amount = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '\'' || r == '’' {
+			return -1
+		}
+		return r
+	}, amount)
+	if amount == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	decimalSep := -1
+	lastDot, lastComma := strings.LastIndex(amount, "."), strings.LastIndex(amount, ",")
+	if lastDot >= 0 && lastComma >= 0 {
+		if lastDot > lastComma {
+			decimalSep = lastDot
+		} else {
+			decimalSep = lastComma
+		}
+	} else if sep := lastDot + lastComma + 1; sep >= 0 {
+		// only one kind of separator is used
+		if strings.Count(amount, amount[sep:sep+1]) == 1 && len(amount)-sep-1 != 3 {
+			decimalSep = sep
+		}
+	}
+
+	intPart, fracPart := amount, ""
+	if decimalSep >= 0 {
+		intPart, fracPart = amount[:decimalSep], amount[decimalSep+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("no digits in amount: %s", amount)
+	}
+	if len(fracPart) > 2 {
+		return 0, fmt.Errorf("too many decimal digits: %s", amount)
+	}
+	fracPart += strings.Repeat("0", 2-len(fracPart))
+	if intPart == "" {
+		intPart = "0"
+	}
+	if strings.IndexFunc(intPart, isGroupSeparator) >= 0 {
+		groups := strings.FieldsFunc(intPart, isGroupSeparator)
+		if !validGroups(intPart, groups) {
+			return 0, fmt.Errorf("wrong thousands grouping: %s", amount)
+		}
+		intPart = strings.Join(groups, "")
+	}
+
+	units, err := strconv.ParseUint(intPart, 10, 63)
 	if err != nil {
-		return 0, nil, err
+		return 0, err
 	}
-	return value, c, nil
+	if units >= math.MaxInt64/100 {
+		return 0, fmt.Errorf("amount is too large: %s", amount)
+	}
+	cents, err := strconv.ParseUint(fracPart, 10, 8)
+	if err != nil {
+		return 0, err
+	}
+	if units == 0 && cents == 0 {
+		return 0, fmt.Errorf("zero amount: %s", amount)
+	}
+	return int64(units*100 + cents), nil
+}
+
+func isGroupSeparator(r rune) bool {
+	return r == '.' || r == ','
+}
+
+// validGroups checks that thousands are grouped by one kind of separator: "1.200.000", not "1.2,000".
+func validGroups(intPart string, groups []string) bool {
+	if len(groups) < 2 || strings.ContainsRune(intPart, '.') && strings.ContainsRune(intPart, ',') {
+		return false
+	}
+	for i, group := range groups {
+		if i == 0 && (len(group) == 0 || len(group) > 3) || i > 0 && len(group) != 3 {
+			return false
+		}
+	}
+	return len(strings.Join(groups, "")) == len(intPart)-len(groups)+1
 }
 
 func InitCurCash() *CurCash {
 	curMap := map[string](map[string]Currency){}
-	return &CurCash{m: curMap}
+	return &CurCash{
+		m:          curMap,
+		calls:      map[string]*rateCall{},
+		currencies: defaultCurrencies,
+		aliases:    newCurrencyAliases(defaultCurrencies),
+		load:       loadValueMap,
+	}
 }
 
-func (c *CurCash) Get(date time.Time, code string) (*Currency, error) {
+// SetCurrencies replaces the known currencies and their aliases, e.g. with the ones from the currencies table.
+func (c *CurCash) SetCurrencies(currencies []CurrencyInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.currencies = currencies
+	c.aliases = newCurrencyAliases(currencies)
+}
+
+func (c *CurCash) Aliases() CurrencyAliases {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.aliases
+}
+
+// Get is safe for concurrent use. Rates for a date are loaded once, concurrent callers wait for that load.
+func (c *CurCash) Get(ctx context.Context, date time.Time, code string) (*Currency, error) {
 	if code == "RUB" {
 		return &Currency{
 			NumCode: 643,
@@ -39,31 +174,79 @@ func (c *CurCash) Get(date time.Time, code string) (*Currency, error) {
 	}
 
 	dateName := date.Format("2006-01-02")
-	var result *Currency
+	// the second attempt loads the rates again if a concurrent load was done for another currency
+	for attempt := 0; attempt < 2; attempt++ {
+		c.mu.Lock()
+		if currency, ok := c.m[dateName][code]; ok {
+			c.mu.Unlock()
+			return &currency, nil
+		}
+		call, ok := c.calls[dateName]
+		if !ok {
+			call = &rateCall{done: make(chan struct{})}
+			c.calls[dateName] = call
+			go c.loadRates(ctx, call, date, code, c.currencies)
+		}
+		c.mu.Unlock()
 
-	if _, ok := c.m[dateName]; ok {
-		currency := c.m[dateName][code]
-		result = &currency
-	} else {
-		if _, err := os.Stat(fmt.Sprintf("cmd/filecache/%s.xml", dateName)); err != nil && os.IsNotExist(err) {
-			err = createCurFile(date)
-			if err != nil {
-				return nil, err
-			}
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-		valCurs, err := readFile(fmt.Sprintf("cmd/filecache/%s.xml", dateName))
-		if err != nil {
-			return nil, err
+		if call.err != nil {
+			return nil, call.err
 		}
-		valueMap, err := parseValCurs(valCurs)
-		if err != nil {
-			return nil, err
+		if currency, ok := call.valueMap[code]; ok {
+			return &currency, nil
 		}
+	}
+	return nil, fmt.Errorf("no exchange rate for %s on %s", code, dateName)
+}
+
+// loadRates loads the rates for the date of the call. The load has a context of its own,
+// so the caller that started it and gave up does not fail the others waiting for it.
+func (c *CurCash) loadRates(ctx context.Context, call *rateCall, date time.Time, code string, currencies []CurrencyInfo) {
+	loadCtx, cancel := context.WithTimeout(log.Ctx(ctx).WithContext(context.Background()), RatesLoadTimeout)
+	defer cancel()
+	valueMap, err := c.load(loadCtx, date, code, currencies)
+
+	dateName := date.Format("2006-01-02")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call.valueMap, call.err = valueMap, err
+	if err == nil {
 		c.m[dateName] = valueMap
-		res := valueMap[code]
-		result = &res
 	}
-	return result, nil
+	delete(c.calls, dateName)
+	close(call.done)
+}
+
+// loadValueMap reads the rates for the date from the file cache and downloads them if the file has no code.
+func loadValueMap(ctx context.Context, date time.Time, code string, currencies []CurrencyInfo) (map[string]Currency, error) {
+	fileName := fmt.Sprintf("cmd/filecache/%s.xml", date.Format("2006-01-02"))
+	valueMap, err := readValueMap(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, ok := valueMap[code]; ok {
+		return valueMap, nil
+	}
+
+	// the file was saved before the currency became known
+	err = createCurFile(ctx, date, currencies)
+	if err != nil {
+		return nil, err
+	}
+	return readValueMap(fileName)
+}
+
+func readValueMap(fileName string) (map[string]Currency, error) {
+	valCurs, err := readFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return parseValCurs(valCurs)
 }
 
 func parseValCurs(valCurs *ValCurs) (map[string]Currency, error) {
@@ -107,42 +290,48 @@ func getSymbol(code string) string {
 	}
 }
 
-func parseAmount(amount string, cash *CurCash, date time.Time) (int64, *Currency, error) {
+// parseAmount parses an amount with an optional currency before or after it: "500", "$12", "12 usd", "1200дин".
+// The amount may be an expression like "120+80€". Without a currency the amount is in rubles.
+func parseAmount(ctx context.Context, amount string, cash *CurCash, date time.Time) (int64, *Currency, error) {
 	amount = strings.ToLower(amount)
 	amount = strings.TrimSpace(amount)
-	if strings.HasSuffix(amount, getSymbol("EUR")) {
-		return getAmount("EUR", amount, cash, date)
-	} else if strings.HasSuffix(amount, getSymbol("USD")) {
-		return getAmount("USD", amount, cash, date)
-	} else if strings.HasSuffix(amount, getSymbol("TRY")) {
-		return getAmount("TRY", amount, cash, date)
-	} else if strings.HasSuffix(amount, getSymbol("GBP")) {
-		return getAmount("GBP", amount, cash, date)
-	} else if strings.HasSuffix(amount, getSymbol("RUB")) {
-		return getAmount("RUB", amount, cash, date)
-	} else {
-		value, err := strconv.ParseInt(amount, 10, 64)
-		if err != nil {
-			return 0, nil, err
-		}
-		currency, err := cash.Get(date, "RUB")
-		if err != nil {
-			return 0, nil, err
+	m := amountPattern.FindStringSubmatch(amount)
+	if m == nil {
+		return 0, nil, fmt.Errorf("unable to parse amount: %s", amount)
+	}
+	prefix, number, suffix := strings.TrimSpace(m[1]), m[2], strings.TrimSuffix(strings.TrimSpace(m[3]), ".")
+	if prefix != "" && suffix != "" {
+		return 0, nil, fmt.Errorf("currency is set twice: %s", amount)
+	}
+
+	code := "RUB"
+	if alias := prefix + suffix; alias != "" {
+		var ok bool
+		code, ok = cash.Aliases().Lookup(alias)
+		if !ok {
+			return 0, nil, fmt.Errorf("unknown currency: %s", alias)
 		}
-		return value, currency, nil
 	}
-}
 
-func getAmount(code string, amount string, cash *CurCash, date time.Time) (int64, *Currency, error) {
-	currency, err := cash.Get(date, code)
+	var value int64
+	var err error
+	if isExpression(number) {
+		value, err = evalAmount(number)
+	} else {
+		value, err = parseMinorUnits(number)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	currency, err := cash.Get(ctx, date, code)
 	if err != nil {
 		return 0, nil, err
 	}
-	return currency.getAmount(amount)
+	return value, currency, nil
 }
 
-func createCurFile(date time.Time) error {
-	valCurs, err := getAllValCurs(date)
+func createCurFile(ctx context.Context, date time.Time, currencies []CurrencyInfo) error {
+	valCurs, err := getAllValCurs(ctx, date, currencies)
 	if err != nil {
 		return err
 	}
@@ -204,94 +393,69 @@ func getDateParam(date time.Time) string {
 	return ""
 }
 
-func getAllValCurs(date time.Time) (*ValCurs, error) {
-	dateParam := getDateParam(date)
-
-	eurValue, err := callCurrencyapi("EUR", dateParam)
-	if err != nil {
-		return nil, err
-	}
-	eur := Valute{
-		ID:       "R01239",
-		NumCode:  "978",
-		CharCode: "EUR",
-		Nominal:  "1",
-		Name:     "Евро",
-		Value:    fmt.Sprintf("%f", eurValue),
+// getAllValCurs loads the rates of all currencies to RUB with a single request.
+func getAllValCurs(ctx context.Context, date time.Time, currencies []CurrencyInfo) (*ValCurs, error) {
+	var codes []string
+	for _, currency := range currencies {
+		if currency.Code != "RUB" {
+			codes = append(codes, currency.Code)
+		}
 	}
-
-	usdValue, err := callCurrencyapi("USD", dateParam)
+	values, err := callCurrencyapi(ctx, codes, getDateParam(date))
 	if err != nil {
 		return nil, err
 	}
-	usd := Valute{
-		ID:       "R01235",
-		NumCode:  "840",
-		CharCode: "USD",
-		Nominal:  "1",
-		Name:     "Доллар США",
-		Value:    fmt.Sprintf("%f", usdValue),
-	}
 
-	rsdValue, err := callCurrencyapi("RSD", dateParam)
-	if err != nil {
-		return nil, err
-	}
-	rsd := Valute{
-		ID:       "R01805F",
-		NumCode:  "941",
-		CharCode: "RSD",
-		Nominal:  "100",
-		Name:     "Сербских динаров",
-		Value:    fmt.Sprintf("%f", rsdValue*100),
+	valCurs := ValCurs{}
+	for _, currency := range currencies {
+		value, ok := values[currency.Code]
+		if !ok || value.Value == 0 {
+			continue
+		}
+		valCurs.Valute = append(valCurs.Valute, Valute{
+			NumCode:  strconv.FormatInt(currency.NumCode, 10),
+			CharCode: currency.Code,
+			Nominal:  "1",
+			Name:     currency.Title,
+			Value:    strconv.FormatFloat(1/value.Value, 'f', -1, 64),
+		})
 	}
+	return &valCurs, nil
+}
 
-	tryValue, err := callCurrencyapi("TRY", dateParam)
+// callCurrencyapi returns how many units of each currency one RUB costs.
+func callCurrencyapi(ctx context.Context, codes []string, dateParam string) (map[string]CurrencyValue, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.currencyapi.com/v3/latest?apikey="+os.Getenv("CURRENCYAPI_TOKEN")+"&base_currency=RUB&currencies="+strings.Join(codes, ",")+dateParam, nil)
 	if err != nil {
 		return nil, err
 	}
-	try := Valute{
-		ID:       "R01700J",
-		NumCode:  "949",
-		CharCode: "TRY",
-		Nominal:  "10",
-		Name:     "Турецких лир",
-		Value:    fmt.Sprintf("%f", tryValue*10),
-	}
-
-	valCurs := ValCurs{
-		Valute: []Valute{eur, usd, rsd, try},
-	}
-	return &valCurs, nil
-}
-
-func callCurrencyapi(code string, dateParam string) (float64, error) {
-	response, err := http.Get("https://api.currencyapi.com/v3/latest?apikey=" + os.Getenv("CURRENCYAPI_TOKEN") + "&currencies=RUB&base_currency=" + code + dateParam)
+	response, err := httpClient.Do(req)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer func() { _ = response.Body.Close() }()
 	responseData, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	var responseObject Response
 	err = json.Unmarshal(responseData, &responseObject)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return responseObject.Data.Rub.Value, nil
+	return responseObject.Data, nil
 }
 
 func (v *Valute) getExRate() (*big.Float, error) {
 	str := strings.Replace(v.Value, ",", ".", 1)
 	value, err := strconv.ParseFloat(str, 64)
 	if err != nil {
-		log.Error().Err(err).Msgf("unable to parse value: %w", err)
+		log.Error().Err(err).Msgf("unable to parse value: %s", v.Value)
 		return big.NewFloat(0), err
 	}
 	nominal, err := strconv.ParseInt(v.Nominal, 10, 64)
 	if err != nil {
-		log.Error().Err(err).Msgf("unable to parse nominal: %w", err)
+		log.Error().Err(err).Msgf("unable to parse nominal: %s", v.Nominal)
 		return big.NewFloat(0), err
 	}
 
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testRate(code string, rate float64) Currency {
+	return Currency{Code: code, ExRate: big.NewFloat(rate), Symbol: getSymbol(code)}
+}
+
+func TestCurCashLoadsOnce(t *testing.T) {
+	date := time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)
+	cash := InitCurCash()
+	var calls int32
+	cash.load = func(ctx context.Context, date time.Time, code string, currencies []CurrencyInfo) (map[string]Currency, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return map[string]Currency{"EUR": testRate("EUR", 80), "USD": testRate("USD", 75)}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		code := "EUR"
+		if i%2 == 1 {
+			code = "USD"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cash.Get(context.Background(), date, code); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("rates loaded %d times, want once", calls)
+	}
+}
+
+func TestCurCashWaiterOutlivesCaller(t *testing.T) {
+	date := time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)
+	cash := InitCurCash()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cash.load = func(ctx context.Context, date time.Time, code string, currencies []CurrencyInfo) (map[string]Currency, error) {
+		close(started)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return map[string]Currency{"EUR": testRate("EUR", 80)}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := cash.Get(ctx, date, "EUR")
+		first <- err
+	}()
+	<-started
+	second := make(chan error)
+	go func() {
+		_, err := cash.Get(context.Background(), date, "EUR")
+		second <- err
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("the caller that gave up got %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-second; err != nil {
+		t.Errorf("the waiting caller got %v", err)
+	}
+}
+
+func TestCurCashLoadsAgainForMissingCode(t *testing.T) {
+	date := time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)
+	cash := InitCurCash()
+	var calls int32
+	cash.load = func(ctx context.Context, date time.Time, code string, currencies []CurrencyInfo) (map[string]Currency, error) {
+		// the rates of the first load were saved before AMD became known
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return map[string]Currency{"EUR": testRate("EUR", 80)}, nil
+		}
+		return map[string]Currency{"EUR": testRate("EUR", 80), "AMD": testRate("AMD", 0.2)}, nil
+	}
+
+	currency, err := cash.Get(context.Background(), date, "AMD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if currency.Code != "AMD" || calls != 2 {
+		t.Errorf("got %s after %d loads, want AMD after 2", currency.Code, calls)
+	}
+
+	if _, err := cash.Get(context.Background(), date, "GBP"); err == nil {
+		t.Error("got a rate for GBP that is never loaded")
+	}
+	if calls != 4 {
+		t.Errorf("rates loaded %d times, want 2 more for GBP", calls)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+)
+
+const (
+	DefaultWorkers = 4
+	workerQueue    = 32
+)
+
+// dispatcher handles updates with a fixed number of workers. Updates of a chat always go
+// to the same worker, so they are handled one by one in the order they came.
+type dispatcher struct {
+	queues []chan tgbotapi.Update
+	wg     sync.WaitGroup
+}
+
+func newDispatcher(workers int, handle func(tgbotapi.Update)) *dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &dispatcher{queues: make([]chan tgbotapi.Update, workers)}
+	for i := range d.queues {
+		queue := make(chan tgbotapi.Update, workerQueue)
+		d.queues[i] = queue
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for update := range queue {
+				handle(update)
+			}
+		}()
+	}
+	return d
+}
+
+// Dispatch blocks when the worker of the chat has a full queue.
+func (d *dispatcher) Dispatch(update tgbotapi.Update) {
+	worker := updateChatId(update) % int64(len(d.queues))
+	if worker < 0 {
+		worker = -worker
+	}
+	d.queues[worker] <- update
+}
+
+// Close stops accepting updates and waits until the queued ones are handled.
+func (d *dispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func updateChatId(update tgbotapi.Update) int64 {
+	// callbacks from inline messages have no chat
+	if update.CallbackQuery == nil || update.CallbackQuery.Message != nil {
+		if chat := update.FromChat(); chat != nil {
+			return chat.ID
+		}
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"sync"
+	"testing"
+)
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := map[int64][]int{}
+	d := newDispatcher(3, func(update tgbotapi.Update) {
+		mu.Lock()
+		defer mu.Unlock()
+		chatId := update.Message.Chat.ID
+		handled[chatId] = append(handled[chatId], update.UpdateID)
+	})
+
+	chats := []int64{101, -100200300, 7, 42, 100500}
+	for i := 0; i < 100; i++ {
+		chat := &tgbotapi.Chat{ID: chats[i%len(chats)]}
+		d.Dispatch(tgbotapi.Update{UpdateID: i, Message: &tgbotapi.Message{Chat: chat}})
+	}
+	d.Close()
+
+	for _, chatId := range chats {
+		ids := handled[chatId]
+		if len(ids) != 100/len(chats) {
+			t.Errorf("chat %d: handled %d updates, want %d", chatId, len(ids), 100/len(chats))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("chat %d: updates out of order: %v", chatId, ids)
+				break
+			}
+		}
+	}
+}
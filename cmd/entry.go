@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tagPrefix = "#"
+
+var (
+	relativeDays = map[string]int{"сегодня": 0, "вчера": -1, "позавчера": -2}
+	dateToken    = regexp.MustCompile(`^(\d{1,2})\.(\d{1,2})(?:\.(\d{2}|\d{4}))?$`)
+	timeToken    = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+
+	// "1 200" and "1 200,50€" are typed with a space between thousands
+	leadingGroup   = regexp.MustCompile(`^\d{1,3}( \d{3})*$`)
+	thousandsGroup = regexp.MustCompile(`^\d{3}(?:[.,]\d{1,2})?[^\d.,]*$`)
+)
+
+// Entry is a manual expense: "<amount> [currency] <description> [note...] [#tag...]",
+// e.g. "1200 ресторан ужин с Петей #отпуск", "12 eur кофе" or "120 + 80 кафе".
+// BoughtAt is zero unless the text has date tokens like "вчера", "12.03" or "12.03.2023 18:30".
+type Entry struct {
+	Amount      string
+	Description string
+	Note        string
+	Tags        []string
+	BoughtAt    time.Time
+}
+
+// parseEntry parses the text sent at sentAt, relative dates are counted from it.
+// A numeric date before the amount is taken only if it has a year or the amount follows it,
+// so "12.03 кофе" is 12.03 rubles and "12.03 500 кофе" is 500 rubles on 12.03.
+func parseEntry(text string, sentAt time.Time, aliases CurrencyAliases) (*Entry, error) {
+	var words []string
+	var tags []string
+	date := dateOf(sentAt)
+	hasDate := false
+	clock := -1 * time.Minute
+	fields := strings.Fields(text)
+	for i, word := range fields {
+		if tag := parseTag(word); tag != "" {
+			tags = appendTag(tags, tag)
+			continue
+		}
+		if days, ok := relativeDays[strings.ToLower(word)]; ok {
+			date, hasDate = dateOf(sentAt).AddDate(0, 0, days), true
+			continue
+		}
+		if d, ok := parseDate(word, sentAt); ok && (len(words) > 0 || dateBeforeAmount(word, fields[i+1:])) {
+			date, hasDate = d, true
+			continue
+		}
+		if c, ok := parseClock(word); ok {
+			clock = c
+			continue
+		}
+		words = append(words, word)
+	}
+	for len(words) > 2 && (leadingGroup.MatchString(words[0]) && thousandsGroup.MatchString(words[1]) ||
+		operatorSuffix.MatchString(words[0]) || operatorPrefix.MatchString(words[1])) {
+		words = append([]string{words[0] + " " + words[1]}, words[2:]...)
+	}
+	// a currency after a space is a whole word, so "100 рыба" is not in rubles and "100 дин" has no description
+	if len(words) > 1 {
+		if _, ok := aliases.Lookup(strings.TrimSuffix(words[1], ".")); ok {
+			words = append([]string{words[0] + " " + words[1]}, words[2:]...)
+		}
+	}
+	if len(words) < 2 {
+		return nil, fmt.Errorf("entry needs an amount and a description: %q", text)
+	}
+
+	entry := &Entry{
+		Amount:      words[0],
+		Description: words[1],
+		Note:        strings.Join(words[2:], " "),
+		Tags:        tags,
+	}
+	if hasDate || clock >= 0 {
+		if clock < 0 {
+			clock = sentAt.Sub(dateOf(sentAt))
+		}
+		entry.BoughtAt = date.Add(clock)
+		// "23:50" sent at 00:10 is about the previous evening
+		if !hasDate && entry.BoughtAt.After(sentAt) {
+			entry.BoughtAt = entry.BoughtAt.AddDate(0, 0, -1)
+		}
+	}
+	return entry, nil
+}
+
+// dateBeforeAmount tells if the date in the amount position is followed by the amount, maybe after the time.
+func dateBeforeAmount(word string, rest []string) bool {
+	if dateToken.FindStringSubmatch(word)[3] != "" {
+		return true
+	}
+	return len(rest) > 0 && rest[0][0] >= '0' && rest[0][0] <= '9'
+}
+
+// parseDate parses "dd.mm", "dd.mm.yy" and "dd.mm.yyyy". Without a year it is the last such date not after sentAt.
+// The month of "dd.mm" has two digits, so "10.5" stays a number.
+func parseDate(word string, sentAt time.Time) (time.Time, bool) {
+	m := dateToken.FindStringSubmatch(word)
+	if m == nil || m[3] == "" && len(m[2]) != 2 {
+		return time.Time{}, false
+	}
+	day, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	year := sentAt.Year()
+	if m[3] != "" {
+		year, _ = strconv.Atoi(m[3])
+		if year < 100 {
+			year += 2000
+		}
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, sentAt.Location())
+	if date.Day() != day || int(date.Month()) != month {
+		return time.Time{}, false
+	}
+	if m[3] == "" && date.After(sentAt) {
+		date = date.AddDate(-1, 0, 0)
+	}
+	return date, true
+}
+
+func parseClock(word string) (time.Duration, bool) {
+	m := timeToken.FindStringSubmatch(word)
+	if m == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	if hours > 23 || minutes > 59 {
+		return 0, false
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, true
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// parseTag returns the lower-cased tag without "#" or an empty string if the word is not a tag.
+func parseTag(word string) string {
+	if !strings.HasPrefix(word, tagPrefix) {
+		return ""
+	}
+	return strings.ToLower(strings.TrimLeft(word, tagPrefix))
+}
+
+func appendTag(tags []string, tag string) []string {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEntryAmount(t *testing.T) {
+	sentAt := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text        string
+		amount      string
+		description string
+	}{
+		{"500 кафе", "500", "кафе"},
+		{"12.50€ кофе", "12.50€", "кофе"},
+		{"1 200 такси", "1 200", "такси"},
+		{"1 200 000 квартира", "1 200 000", "квартира"},
+		{"1 200,50€ отель", "1 200,50€", "отель"},
+		{"300 кофе 250 грамм", "300", "кофе"},
+		{"12 usd такси", "12 usd", "такси"},
+		{"1 200 дин такси", "1 200 дин", "такси"},
+		{"100р кафе", "100р", "кафе"},
+		{"100 р кафе", "100 р", "кафе"},
+		{"100 р. кафе", "100 р.", "кафе"},
+		{"100 рыба", "100", "рыба"},
+		{"100 бра в спальню", "100", "бра"},
+		{"100 бр ужин", "100 бр", "ужин"},
+		{"100 ft kávé", "100 ft", "kávé"},
+		{"100 ftness", "100", "ftness"},
+		{"120+80+45 кафе", "120+80+45", "кафе"},
+		{"120 + 80 + 45 кафе", "120 + 80 + 45", "кафе"},
+		{"3x250 кофе", "3x250", "кофе"},
+		{"2000 +10% ресторан", "2000 +10%", "ресторан"},
+		{"500 xbox", "500", "xbox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			entry, err := parseEntry(tt.text, sentAt, testCurrencyAliases())
+			if err != nil {
+				t.Fatalf("parseEntry(%q) error: %v", tt.text, err)
+			}
+			if entry.Amount != tt.amount || entry.Description != tt.description {
+				t.Errorf("parseEntry(%q) = %q %q, want %q %q", tt.text, entry.Amount, entry.Description, tt.amount, tt.description)
+			}
+		})
+	}
+}
+
+func TestParseEntryErrors(t *testing.T) {
+	sentAt := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	for _, text := range []string{"кафе", "500", "100 дин", "500 €", "12 usd #отпуск"} {
+		t.Run(text, func(t *testing.T) {
+			if entry, err := parseEntry(text, sentAt, testCurrencyAliases()); err == nil {
+				t.Errorf("parseEntry(%q) = %q %q, want error", text, entry.Amount, entry.Description)
+			}
+		})
+	}
+}
+
+// testCurrencyAliases are the default currencies with some short aliases of the currencies table.
+func testCurrencyAliases() CurrencyAliases {
+	return newCurrencyAliases(append([]CurrencyInfo{
+		{Code: "RUB", Aliases: []string{"₽", "р", "руб"}},
+		{Code: "BYN", Aliases: []string{"бр"}},
+		{Code: "HUF", Aliases: []string{"ft"}},
+	}, defaultCurrencies...))
+}
+
+func TestParseEntryDate(t *testing.T) {
+	sentAt := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text     string
+		amount   string
+		note     string
+		boughtAt time.Time
+	}{
+		{"500 такси 10.5 км", "500", "10.5 км", time.Time{}},
+		{"500 кафе 10.03", "500", "", time.Date(2023, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"500 кафе 10.3.22", "500", "", time.Date(2022, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"12.03 кофе", "12.03", "", time.Time{}},
+		{"12.03 500 кофе", "500", "", time.Date(2023, 3, 12, 12, 0, 0, 0, time.UTC)},
+		{"12.03.2023 18:30 500 кафе", "500", "", time.Date(2023, 3, 12, 18, 30, 0, 0, time.UTC)},
+		{"вчера 500 кафе", "500", "", time.Date(2023, 3, 14, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			entry, err := parseEntry(tt.text, sentAt, testCurrencyAliases())
+			if err != nil {
+				t.Fatalf("parseEntry(%q) error: %v", tt.text, err)
+			}
+			if entry.Amount != tt.amount || entry.Note != tt.note || !entry.BoughtAt.Equal(tt.boughtAt) {
+				t.Errorf("parseEntry(%q) = %q %q %s, want %q %q %s", tt.text, entry.Amount, entry.Note, entry.BoughtAt, tt.amount, tt.note, tt.boughtAt)
+			}
+		})
+	}
+}
+
+func TestParseEntryClock(t *testing.T) {
+	sentAt := time.Date(2023, 3, 15, 0, 10, 0, 0, time.UTC)
+	tests := []struct {
+		text     string
+		boughtAt time.Time
+	}{
+		{"23:50 500 такси", time.Date(2023, 3, 14, 23, 50, 0, 0, time.UTC)},
+		{"00:05 500 такси", time.Date(2023, 3, 15, 0, 5, 0, 0, time.UTC)},
+		{"сегодня 23:50 500 такси", time.Date(2023, 3, 15, 23, 50, 0, 0, time.UTC)},
+		{"15.03 23:50 500 такси", time.Date(2023, 3, 15, 23, 50, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			entry, err := parseEntry(tt.text, sentAt, testCurrencyAliases())
+			if err != nil {
+				t.Fatalf("parseEntry(%q) error: %v", tt.text, err)
+			}
+			if !entry.BoughtAt.Equal(tt.boughtAt) {
+				t.Errorf("parseEntry(%q) bought at %s, want %s", tt.text, entry.BoughtAt, tt.boughtAt)
+			}
+		})
+	}
+}
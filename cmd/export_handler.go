@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/konstantin-yakimenko/home-budget-bot/export"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+const (
+	ErrorParsingExportDates = "Не удалось разобрать даты. Пример: /export 01.01.2023 31.03.2023"
+	ErrorExporting          = "Не удалось выгрузить счета"
+	EmptyExport             = "Нет счетов для выгрузки"
+)
+
+func (a *app) handleExport(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	from, to, err := parseExportDates(message.CommandArguments(), time.Unix(int64(message.Date), 0))
+	if err != nil {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, ErrorParsingExportDates)
+		return
+	}
+
+	bills, err := a.Repository.GetBillsForExport(ctx, message.Chat.ID, from, to)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorExporting, bot, message)
+		return
+	}
+	if len(bills) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, EmptyExport)
+		return
+	}
+	items, err := a.Repository.GetItemsForExport(ctx, message.Chat.ID, from, to)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorExporting, bot, message)
+		return
+	}
+
+	data, err := export.Workbook(bills, items)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorExporting, bot, message)
+		return
+	}
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("report_%s.xlsx", time.Unix(int64(message.Date), 0).Format("20060102")),
+		Bytes: data,
+	})
+	doc.ReplyToMessageID = message.MessageID
+	_, err = bot.Send(doc)
+	if err != nil {
+		log.Ctx(ctx).Error().Stack().Err(err).Msg("error sending document")
+		return
+	}
+	log.Ctx(ctx).Info().Int("bills", len(bills)).Msg("bills exported")
+}
+
+// parseExportDates accepts "[from] [to]" as dd.mm.yyyy, both ends included.
+// Without dates all bills are exported, without the end date - everything up to now.
+func parseExportDates(args string, now time.Time) (time.Time, time.Time, error) {
+	from := time.Time{}
+	to := now.AddDate(0, 0, 1)
+
+	dates := strings.Fields(args)
+	if len(dates) > 2 {
+		return from, to, fmt.Errorf("unexpected export dates: %s", args)
+	}
+	var err error
+	if len(dates) > 0 {
+		from, err = time.Parse("02.01.2006", dates[0])
+		if err != nil {
+			return from, to, err
+		}
+	}
+	if len(dates) > 1 {
+		to, err = time.Parse("02.01.2006", dates[1])
+		if err != nil {
+			return from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	expressionOperator = regexp.MustCompile(`[+×*%]|[\d.,]\s*[-xх]\s*[\d.,]`)
+	operatorPrefix     = regexp.MustCompile(`^(?:[+\-×*]|[xх]\d)`)
+	operatorSuffix     = regexp.MustCompile(`[+\-×*xх]$`)
+)
+
+// isExpression reports whether the amount is an expression like "120+80" rather than a plain number.
+func isExpression(amount string) bool {
+	return expressionOperator.MatchString(amount)
+}
+
+// evalAmount evaluates "120+80+45", "3x250", "2000+10%" or "2000-15%" into cents.
+// Multiplication binds tighter than addition, a percentage added or subtracted is taken of the sum to its left.
+func evalAmount(expression string) (int64, error) {
+	tokens, err := tokenizeAmount(expression)
+	if err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	var sum int64
+	sign := int64(1)
+	for i := 0; i < len(tokens); {
+		value, percent, next, err := evalTerm(tokens, i)
+		if err != nil {
+			return 0, err
+		}
+		if percent {
+			value, err = mulDiv(sum, value, 10000)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if value > math.MaxInt64-absInt64(sum) {
+			return 0, fmt.Errorf("amount is too large: %s", expression)
+		}
+		sum += sign * value
+		if next == len(tokens) {
+			break
+		}
+		switch tokens[next].op {
+		case '+':
+			sign = 1
+		case '-':
+			sign = -1
+		default:
+			return 0, fmt.Errorf("unexpected operator %q in %s", tokens[next].op, expression)
+		}
+		i = next + 1
+		if i == len(tokens) {
+			return 0, fmt.Errorf("expression ends with an operator: %s", expression)
+		}
+	}
+	if sum <= 0 {
+		return 0, fmt.Errorf("amount is not positive: %s", expression)
+	}
+	return sum, nil
+}
+
+type amountToken struct {
+	op      rune
+	value   int64
+	percent bool
+}
+
+// evalTerm multiplies the factors starting at tokens[i]. A term consisting of a single percentage is returned as is.
+func evalTerm(tokens []amountToken, i int) (int64, bool, int, error) {
+	if tokens[i].op != 0 {
+		return 0, false, i, fmt.Errorf("number expected, got %q", tokens[i].op)
+	}
+	value, percent := tokens[i].value, tokens[i].percent
+	i++
+	for i < len(tokens) && tokens[i].op == '×' {
+		if i+1 == len(tokens) || tokens[i+1].op != 0 {
+			return 0, false, i, fmt.Errorf("number expected after multiplication")
+		}
+		factor := tokens[i+1]
+		var err error
+		switch {
+		case percent && factor.percent:
+			return 0, false, i, fmt.Errorf("percentage multiplied by percentage")
+		case percent:
+			value, err = mulDiv(factor.value, value, 10000)
+			percent = false
+		case factor.percent:
+			value, err = mulDiv(value, factor.value, 10000)
+		default:
+			value, err = mulDiv(value, factor.value, 100)
+		}
+		if err != nil {
+			return 0, false, i, err
+		}
+		i += 2
+	}
+	return value, percent, i, nil
+}
+
+func tokenizeAmount(expression string) ([]amountToken, error) {
+	var tokens []amountToken
+	var number strings.Builder
+	flush := func(percent bool) error {
+		if number.Len() == 0 {
+			if percent {
+				return fmt.Errorf("percent sign without a number: %s", expression)
+			}
+			return nil
+		}
+		value, err := parseMinorUnits(number.String())
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, amountToken{value: value, percent: percent})
+		number.Reset()
+		return nil
+	}
+
+	for _, r := range expression {
+		switch r {
+		case '+', '-':
+			if err := flush(false); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, amountToken{op: r})
+		case '×', '*', 'x', 'х':
+			if err := flush(false); err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, amountToken{op: '×'})
+		case '%':
+			if err := flush(true); err != nil {
+				return nil, err
+			}
+		default:
+			number.WriteRune(r)
+		}
+	}
+	if err := flush(false); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// mulDiv returns a*b/d rounded half away from zero, it fails if a*b does not fit into int64.
+func mulDiv(a int64, b int64, d int64) (int64, error) {
+	if b != 0 && absInt64(a) > math.MaxInt64/absInt64(b) {
+		return 0, fmt.Errorf("amount is too large")
+	}
+	p := a * b
+	q, r := p/d, absInt64(p%d)
+	if 2*r >= d {
+		if p < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q, nil
+}
+
+func absInt64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
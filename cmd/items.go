@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"regexp"
+	"strings"
+)
+
+const (
+	UsageItem            = "Примеры: /item пиво Алкоголь, /item детерџент|омекшивач -> Дом и ремонт. Категория «-» удаляет правило"
+	NoItemRules          = "Правил для товаров пока нет"
+	ItemRuleSaved        = "Товары «%s» → «%s»"
+	ItemRuleDeleted      = "Правило для «%s» удалено"
+	ItemRuleNotFound     = "Правило для «%s» не найдено"
+	ErrorItemPattern     = "Не удалось разобрать выражение «%s»"
+	ErrorGettingItemRule = "Не удалось получить правила для товаров"
+	ErrorSavingItemRule  = "Не удалось сохранить правило для товаров"
+)
+
+type itemMatcher struct {
+	pattern  *regexp.Regexp
+	category string
+}
+
+// compileItemRule makes the pattern case-insensitive, a keyword matches any name containing it.
+func compileItemRule(rule ItemRule) (itemMatcher, error) {
+	pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+	if err != nil {
+		return itemMatcher{}, err
+	}
+	return itemMatcher{pattern: pattern, category: rule.Category}, nil
+}
+
+// itemCategory returns the category of the first matching rule or an empty string.
+func itemCategory(matchers []itemMatcher, name string) string {
+	for _, matcher := range matchers {
+		if matcher.pattern.MatchString(name) {
+			return matcher.category
+		}
+	}
+	return ""
+}
+
+// categorizeItems sets the categories of the receipt items. The items without a rule
+// and all items if the rules are not available are counted in the category of the bill.
+func (a *app) categorizeItems(ctx context.Context, bill *Bill) {
+	if len(bill.Items) == 0 {
+		return
+	}
+	rules, err := a.Repository.GetItemRules(ctx)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg(ErrorGettingItemRule)
+		return
+	}
+	var matchers []itemMatcher
+	for _, rule := range rules {
+		matcher, err := compileItemRule(rule)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Msgf("wrong item rule: %s", rule.Pattern)
+			continue
+		}
+		matchers = append(matchers, matcher)
+	}
+	for i := range bill.Items {
+		bill.Items[i].Category = itemCategory(matchers, bill.Items[i].Name)
+	}
+}
+
+// handleItem lists the item rules or saves the "<pattern> <category>" one.
+func (a *app) handleItem(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if strings.TrimSpace(message.CommandArguments()) == "" {
+		a.listItemRules(ctx, bot, message)
+		return
+	}
+	pattern, category, ok := parseRuleArgs(message.CommandArguments())
+	if !ok {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageItem)
+		return
+	}
+
+	if category == UnknownCategory {
+		deleted, err := a.Repository.DeleteItemRule(ctx, pattern)
+		if err != nil {
+			a.sendErrMessage(ctx, err, ErrorSavingItemRule, bot, message)
+			return
+		}
+		if !deleted {
+			a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(ItemRuleNotFound, pattern))
+			return
+		}
+		log.Ctx(ctx).Info().Msgf("item rule deleted: %s", pattern)
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(ItemRuleDeleted, pattern))
+		return
+	}
+
+	rule := ItemRule{Pattern: pattern, Category: category}
+	if _, err := compileItemRule(rule); err != nil {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(ErrorItemPattern, pattern))
+		return
+	}
+	err := a.Repository.SaveItemRule(ctx, rule)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingItemRule, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("item rule saved: %s -> %s", pattern, category)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(ItemRuleSaved, pattern, category))
+}
+
+func (a *app) listItemRules(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	rules, err := a.Repository.GetItemRules(ctx)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingItemRule, bot, message)
+		return
+	}
+	if len(rules) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, NoItemRules)
+		return
+	}
+
+	var sb strings.Builder
+	for _, rule := range rules {
+		sb.WriteString(fmt.Sprintf("%s → %s\n", rule.Pattern, rule.Category))
+	}
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, sb.String())
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestItemCategory(t *testing.T) {
+	var matchers []itemMatcher
+	for _, rule := range []ItemRule{
+		{Pattern: "пиво|pivo|вино", Category: "Алкоголь"},
+		{Pattern: "детерџент|омекшивач", Category: "Дом и ремонт"},
+		{Pattern: "^хлеб", Category: "Продукты"},
+	} {
+		matcher, err := compileItemRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ПИВО ЈЕЛЕН 0,5Л/КОМ (Ђ)", "Алкоголь"},
+		{"Lav pivo 0.5l", "Алкоголь"},
+		{"Детерџент за судове 1л/КОМ (Ђ)", "Дом и ремонт"},
+		{"Хлеб бели 500г/КОМ (Ђ)", "Продукты"},
+		{"Млеко 2.8% 1л/КОМ (Ђ)", ""},
+	}
+	for _, tt := range tests {
+		if got := itemCategory(matchers, tt.name); got != tt.want {
+			t.Errorf("itemCategory(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := compileItemRule(ItemRule{Pattern: "пиво(", Category: "Алкоголь"}); err == nil {
+		t.Error("want error for a wrong pattern")
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/rs/zerolog/log"
 	"golang.org/x/net/html"
 	"io/ioutil"
 	"net/http"
@@ -11,32 +13,62 @@ import (
 	"unicode"
 )
 
-func (a *app) handleLink(link string) (*Bill, error) {
-	content, err := getHtml(link)
+// httpClient is used for all outgoing requests except the ones to telegram.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// handleLink scrapes the receipt from the tax portal and checks it against the signed vl parameter of the link.
+// When the portal is unavailable the bill is made of the vl parameter alone.
+func (a *app) handleLink(ctx context.Context, link string) (*Bill, error) {
+	verification, err := parseVerificationLink(link)
 	if err != nil {
-		return nil, err
+		log.Ctx(ctx).Warn().Err(err).Msg("error decoding the verification link")
 	}
 
-	doc, err := html.Parse(strings.NewReader(content))
+	bill, err := scrapeBill(ctx, link)
 	if err != nil {
-		return nil, err
+		if verification == nil {
+			return nil, err
+		}
+		log.Ctx(ctx).Warn().Err(err).Msg("error getting the receipt, it is taken from the verification link")
+		bill = verification.Bill()
+	} else if verification != nil {
+		if mismatches := verification.crossCheck(bill); len(mismatches) > 0 {
+			log.Ctx(ctx).Warn().Strs("mismatches", mismatches).Msg("receipt differs from the verification link")
+		}
 	}
-	billContent := findBill(doc)
 
-	bill, err := parseBil(billContent)
+	bill.Category, err = a.receiptCategory(ctx, bill)
 	if err != nil {
 		return nil, err
 	}
+	a.categorizeItems(ctx, bill)
 
 	return bill, nil
 }
 
-func getHtml(link string) (string, error) {
-	req, err := http.NewRequest("GET", link, nil)
+func scrapeBill(ctx context.Context, link string) (*Bill, error) {
+	content, err := getHtml(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	billContent := findBill(doc)
+	if billContent == "" {
+		return nil, fmt.Errorf("no receipt on the page")
+	}
+	return parseBil(billContent)
+}
+
+func getHtml(ctx context.Context, link string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
 		return "", err
 	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := httpClient.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -45,12 +77,22 @@ func getHtml(link string) (string, error) {
 	return string(body), err
 }
 
+// DefaultReceiptDescription is used when the receipt has no shop name.
+const DefaultReceiptDescription = "Супермаркет"
+
+// paymentMethods are the payment lines of the fiscal receipt after the total.
+var paymentMethods = []string{"Готовина", "Платна картица", "Чек", "Инстант плаћање", "Ваучер", "Пренос на рачун", "Друго безготовинско плаћање"}
+
 func parseBil(billContent string) (*Bill, error) {
 	lines := strings.Split(billContent, "\n")
 	var items []Item
 	itemsIndex := -1
 	var totalAmount int64
 	var boughtAt time.Time
+	var invoiceNumber, invoiceCounter string
+	var merchant Merchant
+	var cashier string
+	var payments []string
 	var err error
 
 	for i, line := range lines {
@@ -58,10 +100,16 @@ func parseBil(billContent string) (*Bill, error) {
 			itemsIndex = i + 1
 		}
 		if i == itemsIndex {
+			if i+2 >= len(lines) {
+				return nil, fmt.Errorf("bill items are cut off")
+			}
 			additionalTitleLine := 0
 			if !strings.HasPrefix(lines[i+1], " ") {
 				additionalTitleLine = 1
 			}
+			if i+2+additionalTitleLine >= len(lines) {
+				return nil, fmt.Errorf("bill items are cut off")
+			}
 			item, err := parseItem(lines[i+1+additionalTitleLine])
 			if err != nil {
 				return nil, err
@@ -95,15 +143,64 @@ func parseBil(billContent string) (*Bill, error) {
 				fmt.Println(err)
 			}
 		}
+		if value, ok := fieldValue(line, "ПФР број рачуна:"); ok {
+			invoiceNumber = value
+		}
+		if value, ok := fieldValue(line, "Бројач рачуна:"); ok {
+			invoiceCounter = value
+		}
+
+		if value, ok := fieldValue(line, "ПИБ:"); ok {
+			merchant.Pib = value
+		}
+		if value, ok := fieldValue(line, "Предузеће:"); ok {
+			merchant.Company = value
+		}
+		if value, ok := fieldValue(line, "Место продаје:"); ok {
+			merchant.Name = value
+		}
+		if value, ok := fieldValue(line, "Адреса:"); ok {
+			merchant.Address = value
+		}
+		if value, ok := fieldValue(line, "Општина:"); ok {
+			merchant.Municipality = value
+		}
+		if value, ok := fieldValue(line, "Касир:"); ok {
+			cashier = value
+		}
+		for _, method := range paymentMethods {
+			if strings.HasPrefix(line, method+":") {
+				payments = append(payments, method)
+			}
+		}
 	}
 
-	return &Bill{
+	bill := &Bill{
 		TotalAmount: totalAmount,
 		BoughtAt:    boughtAt,
-		Description: "Супермаркет",
-		Category:    "Продукты",
+		Description: DefaultReceiptDescription,
 		Items:       items,
-	}, nil
+
+		InvoiceNumber:  invoiceNumber,
+		InvoiceCounter: invoiceCounter,
+		Cashier:        cashier,
+		PaymentMethod:  strings.Join(payments, ", "),
+	}
+	if merchant.Pib != "" {
+		bill.Merchant = &merchant
+		if title := merchant.Title(); title != "" {
+			bill.Description = title
+		}
+	}
+	return bill, nil
+}
+
+// fieldValue returns the value of the "Name:   value" line of the fiscal receipt.
+func fieldValue(line string, name string) (string, bool) {
+	if !strings.HasPrefix(line, name) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, name)), true
 }
 
 func parseItem(article string) (*Item, error) {
@@ -137,7 +234,7 @@ func parseItem(article string) (*Item, error) {
 	}
 	item.Sum, err = strToInt(strings.ReplaceAll(article[start:], ",", ""))
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 	return &item, nil
 }
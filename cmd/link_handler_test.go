@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readReceipt(t *testing.T) string {
+	content, err := os.ReadFile("testdata/receipt.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestParseBil(t *testing.T) {
+	bill, err := parseBil(readReceipt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bill.TotalAmount != 38997 {
+		t.Errorf("total = %d, want 38997", bill.TotalAmount)
+	}
+	if want := time.Date(2023, 2, 7, 19, 19, 53, 0, time.UTC); !bill.BoughtAt.Equal(want) {
+		t.Errorf("bought at %s, want %s", bill.BoughtAt, want)
+	}
+	if bill.InvoiceNumber != "8T5MU42C-8T5MU42C-7446" || bill.InvoiceCounter != "7417/7446ПП" {
+		t.Errorf("invoice = %q %q, want %q %q", bill.InvoiceNumber, bill.InvoiceCounter, "8T5MU42C-8T5MU42C-7446", "7417/7446ПП")
+	}
+	want := Merchant{Pib: "100002314", Company: "DELHAIZE SERBIA D.O.O.", Name: "Maxi 124", Address: "Булевар ослобођења 5", Municipality: "Нови Сад"}
+	if bill.Merchant == nil || *bill.Merchant != want {
+		t.Errorf("merchant = %+v, want %+v", bill.Merchant, want)
+	}
+	if bill.Description != "Maxi 124" || bill.Cashier != "Ана Петровић" || bill.PaymentMethod != "Платна картица" {
+		t.Errorf("description, cashier, payment = %q %q %q", bill.Description, bill.Cashier, bill.PaymentMethod)
+	}
+	if len(bill.Items) != 2 || bill.Items[1].Name != "Млеко 2.8% 1л/КОМ (Ђ)" || bill.Items[1].Sum != 29998 {
+		t.Errorf("items = %+v", bill.Items)
+	}
+}
+
+func TestParseBilCutOff(t *testing.T) {
+	receipt := readReceipt(t)
+	receipt = receipt[:strings.Index(receipt, "     89,99")]
+
+	if _, err := parseBil(receipt); err == nil {
+		t.Error("want error for a receipt cut off in the items")
+	}
+}
@@ -6,29 +6,35 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006/02/01 15:04:05"})
+	zerolog.DefaultContextLogger = &log.Logger
 	log.Info().Msg("Starting app")
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	config, err := pgxpool.ParseConfig(os.Getenv("PG_HOMEBUDGET_DB")) // DatabaseURL
 	if err != nil {
-		log.Fatal().Err(err).Msgf("failed to parse conn string (%s): %w", os.Getenv("PG_HOMEBUDGET_DB"), err)
+		log.Fatal().Err(err).Msgf("failed to parse conn string (%s)", os.Getenv("PG_HOMEBUDGET_DB"))
 	}
 
 	pool, err := pgxpool.ConnectConfig(ctx, config)
 	if err != nil {
-		log.Fatal().Err(err).Msgf("unable to connect to database: %w", err)
+		log.Fatal().Err(err).Msg("unable to connect to database")
 	}
 	defer pool.Close()
 
 	app := &app{
 		Repository: NewRepository(pool),
+		errorLog:   DefaultErrorLog,
 	}
 
 	app.Serve(ctx)
+	log.Info().Msg("app stopped")
 }
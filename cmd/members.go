@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessDenied        = "Бот доступен только участникам. Попросите приглашение у администратора"
+	AdminOnly           = "Команда доступна только администраторам"
+	InviteCreated       = "Приглашение действует сутки и только один раз: https://t.me/%s?start=%s\nИли отправьте боту /start %s"
+	InviteInvalid       = "Приглашение не найдено, уже использовано или устарело"
+	InviteAccepted      = "Добро пожаловать! Список команд: /help"
+	UsageKick           = "Отправьте /kick ответом на сообщение участника или /kick <telegram id>"
+	MemberKicked        = "Участник %d удален"
+	MemberNotFound      = "Участник %d не найден или он администратор"
+	ErrorCreatingInvite = "Не удалось создать приглашение"
+	ErrorAcceptInvite   = "Не удалось принять приглашение"
+	ErrorKicking        = "Не удалось удалить участника"
+
+	InviteTTL = 24 * time.Hour
+)
+
+// Members keeps the allow-list in memory, so updates from strangers are dropped without going to the database.
+type Members struct {
+	mu sync.RWMutex
+	m  map[int64]bool // telegram id -> admin
+}
+
+func NewMembers() *Members {
+	return &Members{m: make(map[int64]bool)}
+}
+
+func (m *Members) Set(members map[int64]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.m = members
+}
+
+func (m *Members) Add(telegramId int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.m[telegramId]; !ok {
+		m.m[telegramId] = false
+	}
+}
+
+func (m *Members) Remove(telegramId int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.m, telegramId)
+}
+
+func (m *Members) IsMember(telegramId int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.m[telegramId]
+	return ok
+}
+
+func (m *Members) IsAdmin(telegramId int64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.m[telegramId]
+}
+
+// loadMembers saves the admins from HOMEBUDGET_ADMINS, a comma separated list of telegram ids, and loads the allow-list.
+// The admins removed from the list stay members. If the database is not available, only the admins are allowed.
+func (a *app) loadMembers(ctx context.Context) {
+	members := make(map[int64]bool)
+	var admins []int64
+	for _, value := range strings.Split(os.Getenv("HOMEBUDGET_ADMINS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		telegramId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Error().Err(err).Msgf("wrong admin telegram id: %s", value)
+			continue
+		}
+		admins = append(admins, telegramId)
+		members[telegramId] = true
+	}
+	if len(admins) == 0 {
+		log.Warn().Msg("no admins in HOMEBUDGET_ADMINS, nobody can invite new members")
+	}
+
+	err := a.Repository.SaveAdmins(ctx, admins)
+	if err == nil {
+		members, err = a.Repository.GetMembers(ctx)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("error loading members, only admins are allowed")
+	}
+	a.members.Set(members)
+	log.Info().Msgf("members loaded: %d", len(members))
+}
+
+// redeemInvite handles /start <code> from a user who is not a member yet.
+func (a *app) redeemInvite(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	code := strings.TrimSpace(message.CommandArguments())
+	ok, err := a.Repository.RedeemInvite(ctx, code, message.From.ID, time.Now().Add(-InviteTTL))
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorAcceptInvite, bot, message)
+		return
+	}
+	if !ok {
+		log.Ctx(ctx).Warn().Msg("wrong invite code")
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, InviteInvalid)
+		return
+	}
+	a.members.Add(message.From.ID)
+	log.Ctx(ctx).Info().Msg("invite accepted")
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, InviteAccepted)
+}
+
+func (a *app) handleInvite(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if !a.members.IsAdmin(message.From.ID) {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, AdminOnly)
+		return
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorCreatingInvite, bot, message)
+		return
+	}
+	err = a.Repository.SaveInvite(ctx, code, message.From.ID)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorCreatingInvite, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Msg("invite created")
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(InviteCreated, bot.Self.UserName, code, code))
+}
+
+// handleKick removes a member, the member is taken from the message the command replies to or from the argument.
+func (a *app) handleKick(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if !a.members.IsAdmin(message.From.ID) {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, AdminOnly)
+		return
+	}
+	var telegramId int64
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil {
+		telegramId = reply.From.ID
+	} else {
+		var err error
+		telegramId, err = strconv.ParseInt(strings.TrimSpace(message.CommandArguments()), 10, 64)
+		if err != nil {
+			a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageKick)
+			return
+		}
+	}
+
+	ok, err := a.Repository.DeleteMember(ctx, telegramId)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorKicking, bot, message)
+		return
+	}
+	if !ok {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(MemberNotFound, telegramId))
+		return
+	}
+	a.members.Remove(telegramId)
+	log.Ctx(ctx).Info().Int64("member", telegramId).Msg("member kicked")
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(MemberKicked, telegramId))
+}
+
+func newInviteCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"unicode"
+)
+
+const (
+	UsageMerchant            = "Примеры: /merchant 100002314 Продукты, /merchant apoteka -> Лечение. Категория «-» удаляет правило"
+	NoMerchantRules          = "Правил для магазинов пока нет"
+	MerchantRuleSaved        = "Чеки «%s» → «%s»"
+	MerchantRuleDeleted      = "Правило для «%s» удалено"
+	MerchantRuleNotFound     = "Правило для «%s» не найдено"
+	ErrorGettingMerchantRule = "Не удалось получить правила для магазинов"
+	ErrorSavingMerchantRule  = "Не удалось сохранить правило для магазина"
+)
+
+// receiptCategory picks the category of a fiscal receipt by the merchant rules: PIB first, then the name pattern.
+// Without a rule the description mapping is used, like for manual entries.
+func (a *app) receiptCategory(ctx context.Context, bill *Bill) (string, error) {
+	if bill.Merchant != nil {
+		category, err := a.Repository.GetMerchantCategory(ctx, bill.Merchant)
+		if err != nil || category != "" {
+			return category, err
+		}
+	}
+	return a.Repository.GetCategoryByDescription(ctx, bill.Description)
+}
+
+// handleMerchant lists the merchant rules or saves the "<PIB or name> <category>" one.
+func (a *app) handleMerchant(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if strings.TrimSpace(message.CommandArguments()) == "" {
+		a.listMerchantRules(ctx, bot, message)
+		return
+	}
+	rule, ok := parseMerchantArgs(message.CommandArguments())
+	if !ok {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, UsageMerchant)
+		return
+	}
+
+	if rule.Category == UnknownCategory {
+		deleted, err := a.Repository.DeleteMerchantRule(ctx, rule)
+		if err != nil {
+			a.sendErrMessage(ctx, err, ErrorSavingMerchantRule, bot, message)
+			return
+		}
+		if !deleted {
+			a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(MerchantRuleNotFound, rule.Key()))
+			return
+		}
+		log.Ctx(ctx).Info().Msgf("merchant rule deleted: %s", rule.Key())
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(MerchantRuleDeleted, rule.Key()))
+		return
+	}
+
+	err := a.Repository.SaveMerchantRule(ctx, rule)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingMerchantRule, bot, message)
+		return
+	}
+	log.Ctx(ctx).Info().Msgf("merchant rule saved: %s -> %s", rule.Key(), rule.Category)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(MerchantRuleSaved, rule.Key(), rule.Category))
+}
+
+func (a *app) listMerchantRules(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	rules, err := a.Repository.GetMerchantRules(ctx)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorGettingMerchantRule, bot, message)
+		return
+	}
+	if len(rules) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, NoMerchantRules)
+		return
+	}
+
+	var sb strings.Builder
+	for _, rule := range rules {
+		sb.WriteString(fmt.Sprintf("%s → %s\n", rule.Key(), rule.Category))
+	}
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, sb.String())
+}
+
+// parseMerchantArgs accepts "<PIB> <category>", "<name> <category>" and "<name with spaces> -> <category>".
+// A key of digits only is a PIB, anything else is a part of the shop or company name.
+func parseMerchantArgs(args string) (MerchantRule, bool) {
+	key, category, ok := parseRuleArgs(args)
+	if !ok {
+		return MerchantRule{}, false
+	}
+	if isPib(key) {
+		return MerchantRule{Pib: key, Category: category}, true
+	}
+	return MerchantRule{NamePattern: strings.ToLower(key), Category: category}, true
+}
+
+// ruleSeparators don't include "|" of /rename_category, it is an alternation in item patterns.
+var ruleSeparators = []string{"->", "→"}
+
+// parseRuleArgs splits "<key> <category>" or "<key with spaces> -> <category>".
+func parseRuleArgs(args string) (string, string, bool) {
+	for _, separator := range ruleSeparators {
+		if parts := strings.SplitN(args, separator, 2); len(parts) == 2 {
+			key, category := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			return key, category, key != "" && category != ""
+		}
+	}
+	words := strings.Fields(args)
+	if len(words) < 2 {
+		return "", "", false
+	}
+	return words[0], strings.Join(words[1:], " "), true
+}
+
+func isPib(value string) bool {
+	for _, c := range value {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return value != ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestParseMerchantArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want MerchantRule
+	}{
+		{"100002314 Продукты", MerchantRule{Pib: "100002314", Category: "Продукты"}},
+		{"106884584 Дом и ремонт", MerchantRule{Pib: "106884584", Category: "Дом и ремонт"}},
+		{"Apoteka Лечение", MerchantRule{NamePattern: "apoteka", Category: "Лечение"}},
+		{"Lilly Drogerie -> Дом и ремонт", MerchantRule{NamePattern: "lilly drogerie", Category: "Дом и ремонт"}},
+		{"100002314 -", MerchantRule{Pib: "100002314", Category: UnknownCategory}},
+	}
+	for _, tt := range tests {
+		got, ok := parseMerchantArgs(tt.args)
+		if !ok || got != tt.want {
+			t.Errorf("parseMerchantArgs(%q) = %+v %v, want %+v", tt.args, got, ok, tt.want)
+		}
+	}
+
+	for _, args := range []string{"", "100002314", "-> Продукты", "Maxi ->"} {
+		if got, ok := parseMerchantArgs(args); ok {
+			t.Errorf("parseMerchantArgs(%q) = %+v, want error", args, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"runtime/debug"
+	"time"
+)
+
+// UpdateHandler handles a single update from telegram.
+type UpdateHandler func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update)
+
+// Middleware wraps a handler to do something before or after it for every update.
+type Middleware func(next UpdateHandler) UpdateHandler
+
+// chain wraps the handler into the middlewares, the first one is the outermost.
+func chain(handler UpdateHandler, middlewares ...Middleware) UpdateHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// withLogger puts into ctx a logger with the update and its sender, handlers log through log.Ctx(ctx).
+func withLogger(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		fields := log.With().Int("update", update.UpdateID)
+		if user := update.SentFrom(); user != nil {
+			fields = fields.Int64("user_id", user.ID).Str("user", user.UserName)
+		}
+		logger := fields.Logger()
+		next(logger.WithContext(ctx), bot, update)
+	}
+}
+
+// recoverer keeps the bot running when a handler panics and tells the user the update was not handled.
+func (a *app) recoverer(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Ctx(ctx).Error().Str("stack", string(debug.Stack())).Msgf("panic handling update: %v", r)
+				a.replyInternalError(bot, update)
+			}
+		}()
+		next(ctx, bot, update)
+	}
+}
+
+func (a *app) replyInternalError(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		a.answerCallback(bot, update.CallbackQuery, ErrorInternal)
+		return
+	}
+	message := update.Message
+	if message == nil {
+		message = update.EditedMessage
+	}
+	if message == nil {
+		return
+	}
+	a.storeMessage(message.Text)
+	a.sendMessage(bot, message.Chat.ID, message.MessageID, ErrorInternal)
+}
+
+func withTiming(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		start := time.Now()
+		next(ctx, bot, update)
+		log.Ctx(ctx).Info().Dur("took", time.Since(start)).Msg("update handled")
+	}
+}
+
+// authorize lets through only the updates from members. A stranger can only accept an invite with /start <code>,
+// the buttons pressed by a stranger are answered with a refusal.
+func (a *app) authorize(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		user := update.SentFrom()
+		if user == nil || user.IsBot {
+			log.Ctx(ctx).Warn().Msg("update without a user rejected")
+			return
+		}
+		if a.members.IsMember(user.ID) {
+			next(ctx, bot, update)
+			return
+		}
+
+		message := update.Message
+		if message != nil && message.Command() == CommandStart && message.CommandArguments() != "" {
+			a.redeemInvite(ctx, bot, message)
+			return
+		}
+		log.Ctx(ctx).Warn().Msg("update from a stranger rejected")
+		if update.CallbackQuery != nil {
+			a.answerCallback(bot, update.CallbackQuery, AccessDenied)
+			return
+		}
+		if message != nil && message.Chat.IsPrivate() {
+			a.sendMessage(bot, message.Chat.ID, message.MessageID, AccessDenied)
+		}
+	}
+}
+
+// trackUser keeps the name and the language of the user up to date.
+func (a *app) trackUser(next UpdateHandler) UpdateHandler {
+	return func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		if user := update.SentFrom(); user != nil {
+			if _, err := a.Repository.SaveUser(ctx, user); err != nil {
+				log.Ctx(ctx).Error().Err(err).Msg("error saving user")
+			}
+		}
+		next(ctx, bot, update)
+	}
+}
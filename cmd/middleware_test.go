@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBot returns a bot talking to a fake telegram api that remembers the called methods.
+func testBot(t *testing.T) (*tgbotapi.BotAPI, func() []string) {
+	var mu sync.Mutex
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"message_id":1,"chat":{"id":1}}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), methods[1:]...) // without getMe
+	}
+}
+
+func testMessage(text string) *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: 10,
+		From:      &tgbotapi.User{ID: 1, UserName: "user"},
+		Chat:      &tgbotapi.Chat{ID: 1},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Length: len(command)}}
+	}
+	return message
+}
+
+func TestRecovererRepliesOnPanic(t *testing.T) {
+	a := &app{errorLog: filepath.Join(t.TempDir(), DefaultErrorLog)}
+	bot, methods := testBot(t)
+	handle := chain(func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		var parts []string
+		_ = parts[1]
+	}, withLogger, a.recoverer)
+
+	handle(context.Background(), bot, tgbotapi.Update{UpdateID: 1, Message: testMessage("кафе")})
+
+	if got := methods(); len(got) != 1 || got[0] != "sendMessage" {
+		t.Errorf("called %v, want [sendMessage]", got)
+	}
+	if stored, err := os.ReadFile(a.errorLog); err != nil || string(stored) != "кафе\n" {
+		t.Errorf("stored %q, %v, want the message", stored, err)
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		update tgbotapi.Update
+		want   bool
+	}{
+		{"user", tgbotapi.Update{Message: testMessage("500 кафе")}, true},
+		{"stranger", tgbotapi.Update{Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 5}, Chat: &tgbotapi.Chat{ID: -5, Type: "group"}, Text: "500 кафе"}}, false},
+		{"bot", tgbotapi.Update{Message: &tgbotapi.Message{From: &tgbotapi.User{ID: 2, IsBot: true}, Chat: &tgbotapi.Chat{ID: 2}}}, false},
+		{"channel post", tgbotapi.Update{ChannelPost: &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: 3}}}, false},
+	}
+	a := &app{members: NewMembers()}
+	a.members.Set(map[int64]bool{1: false})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled := false
+			handle := chain(func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+				handled = true
+			}, a.authorize)
+			handle(context.Background(), nil, tt.update)
+			if handled != tt.want {
+				t.Errorf("handled = %v, want %v", handled, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeAnswersStrangerCallback(t *testing.T) {
+	bot, methods := testBot(t)
+	a := &app{members: NewMembers()}
+	a.members.Set(map[int64]bool{1: false})
+	handle := chain(func(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+		t.Error("stranger callback handled")
+	}, a.authorize)
+
+	query := &tgbotapi.CallbackQuery{ID: "1", From: &tgbotapi.User{ID: 5}, Message: testMessage("500 кафе"), Data: "category:1:еда"}
+	handle(context.Background(), bot, tgbotapi.Update{CallbackQuery: query})
+
+	if got := methods(); len(got) != 1 || got[0] != "answerCallbackQuery" {
+		t.Errorf("called %v, want [answerCallbackQuery]", got)
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var handled string
+	route := func(name string) MessageHandler {
+		return func(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+			handled = name
+		}
+	}
+	r := newRouter(route("unknown"))
+	r.Command(CommandStart, "", route("start"))
+	r.Command(CommandUndo, "удалить последний чек", route("undo"))
+	r.Message(isLink, route("link"))
+	r.Message(isMultiLine, route("lines"))
+	r.Message(nil, route("text"))
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"/undo", "undo"},
+		{"/start", "start"},
+		{"/undo@home_budget_bot", "undo"},
+		{"/stats", "unknown"},
+		{SufPursGovRs + "v/?vl=abc", "link"},
+		{"500 кафе\n200 такси", "lines"},
+		{"500 кафе", "text"},
+	}
+	for _, tt := range tests {
+		handled = ""
+		r.Handle(context.Background(), nil, tgbotapi.Update{Message: testMessage(tt.text)})
+		if handled != tt.want {
+			t.Errorf("%q handled by %q, want %q", tt.text, handled, tt.want)
+		}
+	}
+}
+
+func TestRouterHelp(t *testing.T) {
+	r := (&app{}).routes()
+
+	help := r.Help()
+	for _, command := range r.BotCommands() {
+		if !strings.Contains(help, "/"+command.Command+" — ") {
+			t.Errorf("help has no /%s", command.Command)
+		}
+		if len(command.Description) > 256 {
+			t.Errorf("/%s description is too long for telegram", command.Command)
+		}
+	}
+	if strings.Contains(help, "/"+CommandStart) {
+		t.Errorf("help lists /%s", CommandStart)
+	}
+}
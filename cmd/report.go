@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ErrorParsingPeriod = "Не удалось разобрать период. Примеры: /report, /report 03.2023, /report 01.03.2023-15.03.2023, /report я 03.2023, /report #отпуск"
+	ErrorMakingReport  = "Не удалось построить отчет"
+	EmptyReport        = "Нет расходов за %s"
+	TotalTitle         = "Итого"
+	PayersTitle        = "Кто платил:"
+	NewCategoryDelta   = "новая"
+)
+
+var myReportTokens = map[string]bool{"я": true, "me": true, "my": true, "мои": true}
+
+type Period struct {
+	From  time.Time
+	To    time.Time
+	Label string
+}
+
+// Previous returns the period of the same length right before this one, i.e. the previous month for a month.
+func (p Period) Previous() Period {
+	if p.From.Day() == 1 && p.To.Equal(p.From.AddDate(0, 1, 0)) {
+		from := p.From.AddDate(0, -1, 0)
+		return Period{From: from, To: p.From, Label: from.Format("01.2006")}
+	}
+	from := p.From.Add(-p.To.Sub(p.From))
+	return Period{From: from, To: p.From, Label: rangeLabel(from, p.From)}
+}
+
+func (a *app) handleReport(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	filter, args := reportScope(message)
+	period, err := parsePeriod(args, time.Unix(int64(message.Date), 0))
+	if err != nil {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, ErrorParsingPeriod)
+		return
+	}
+
+	current, err := a.Repository.GetCategoryTotals(ctx, period.From, period.To, filter)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorMakingReport, bot, message)
+		return
+	}
+	if len(current) == 0 {
+		a.sendMessage(bot, message.Chat.ID, message.MessageID, fmt.Sprintf(EmptyReport, period.Label))
+		return
+	}
+	previousPeriod := period.Previous()
+	previous, err := a.Repository.GetCategoryTotals(ctx, previousPeriod.From, previousPeriod.To, filter)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorMakingReport, bot, message)
+		return
+	}
+
+	payers, err := a.Repository.GetPayerTotals(ctx, period.From, period.To, filter)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorMakingReport, bot, message)
+		return
+	}
+
+	a.sendHTMLMessage(bot, message.Chat.ID, message.MessageID, formatReport(period, previousPeriod, filter, current, previous, payers))
+}
+
+// reportScope splits off the "я"/"me" token which limits the report to the user's own bills
+// and #tags which limit it to bills with any of the tags.
+func reportScope(message *tgbotapi.Message) (ReportFilter, string) {
+	var args []string
+	filter := ReportFilter{ChatId: message.Chat.ID}
+	for _, arg := range strings.Fields(message.CommandArguments()) {
+		if myReportTokens[strings.ToLower(arg)] {
+			filter.TelegramId = message.From.ID
+			continue
+		}
+		if tag := parseTag(arg); tag != "" {
+			filter.Tags = appendTag(filter.Tags, tag)
+			continue
+		}
+		args = append(args, arg)
+	}
+	return filter, strings.Join(args, " ")
+}
+
+// parsePeriod accepts an empty string (current month), a month ("03.2023", "2023-03")
+// or a range of days ("01.03.2023-15.03.2023"), both ends included.
+func parsePeriod(args string, now time.Time) (Period, error) {
+	args = strings.ReplaceAll(strings.TrimSpace(args), " ", "")
+	if args == "" {
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return Period{From: from, To: from.AddDate(0, 1, 0), Label: from.Format("01.2006")}, nil
+	}
+	for _, layout := range []string{"01.2006", "2006-01"} {
+		if from, err := time.Parse(layout, args); err == nil {
+			return Period{From: from, To: from.AddDate(0, 1, 0), Label: from.Format("01.2006")}, nil
+		}
+	}
+
+	bounds := strings.Split(args, "-")
+	if len(bounds) != 2 {
+		return Period{}, fmt.Errorf("unexpected period: %s", args)
+	}
+	from, err := time.Parse("02.01.2006", bounds[0])
+	if err != nil {
+		return Period{}, err
+	}
+	to, err := time.Parse("02.01.2006", bounds[1])
+	if err != nil {
+		return Period{}, err
+	}
+	if to.Before(from) {
+		return Period{}, fmt.Errorf("period ends before it starts: %s", args)
+	}
+	to = to.AddDate(0, 0, 1)
+	return Period{From: from, To: to, Label: rangeLabel(from, to)}, nil
+}
+
+func rangeLabel(from time.Time, to time.Time) string {
+	return from.Format("02.01.2006") + "–" + to.AddDate(0, 0, -1).Format("02.01.2006")
+}
+
+// formatReport lists who paid only if the bills were paid by several people.
+func formatReport(period Period, previousPeriod Period, filter ReportFilter, current []CategoryTotal, previous []CategoryTotal, payers []PayerTotal) string {
+	previousRub := map[string]int64{}
+	var previousTotal int64
+	for _, total := range previous {
+		previousRub[total.Category] = total.AmountRub
+		previousTotal += total.AmountRub
+	}
+
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].AmountRub > current[j].AmountRub
+	})
+
+	rows := [][]string{{"Категория", "RUB", "USD", "Δ"}}
+	var totalRub, totalUsd int64
+	for _, total := range current {
+		rows = append(rows, []string{
+			total.Category,
+			formatMoney(total.AmountRub),
+			formatMoney(total.AmountUsd),
+			formatDelta(total.AmountRub, previousRub[total.Category]),
+		})
+		totalRub += total.AmountRub
+		totalUsd += total.AmountUsd
+		delete(previousRub, total.Category)
+	}
+	// the categories left are the ones spent on in the previous period only
+	sort.Slice(previous, func(i, j int) bool {
+		return previous[i].AmountRub > previous[j].AmountRub
+	})
+	for _, total := range previous {
+		if _, ok := previousRub[total.Category]; ok {
+			rows = append(rows, []string{total.Category, formatMoney(0), formatMoney(0), formatDelta(0, total.AmountRub)})
+		}
+	}
+	rows = append(rows, []string{TotalTitle, formatMoney(totalRub), formatMoney(totalUsd), formatDelta(totalRub, previousTotal)})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<b>Отчет за %s</b>", html.EscapeString(period.Label)))
+	for _, tag := range filter.Tags {
+		sb.WriteString(" " + html.EscapeString(tagPrefix+tag))
+	}
+	sb.WriteString("\n")
+	sb.WriteString("<pre>")
+	sb.WriteString(html.EscapeString(formatTable(rows)))
+	sb.WriteString("</pre>\n")
+	sb.WriteString(html.EscapeString(fmt.Sprintf("За %s: %s RUB, разница %s RUB",
+		previousPeriod.Label, formatMoney(previousTotal), formatSignedMoney(totalRub-previousTotal))))
+	if len(payers) > 1 {
+		sb.WriteString("\n\n" + PayersTitle)
+		for _, payer := range payers {
+			sb.WriteString(html.EscapeString(fmt.Sprintf("\n%s: %s RUB", payer.Name, formatMoney(payer.AmountRub))))
+		}
+	}
+	return sb.String()
+}
+
+// formatTable aligns the first column to the left and the others to the right.
+func formatTable(rows [][]string) string {
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, row := range rows {
+		for i, cell := range row {
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i == 0 {
+				sb.WriteString(cell + padding)
+			} else {
+				sb.WriteString(" " + padding + cell)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// formatMoney formats minor units as "12 345.67".
+func formatMoney(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	units := fmt.Sprintf("%d", amount/100)
+	var groups []string
+	for len(units) > 3 {
+		groups = append([]string{units[len(units)-3:]}, groups...)
+		units = units[:len(units)-3]
+	}
+	groups = append([]string{units}, groups...)
+	return fmt.Sprintf("%s%s.%02d", sign, strings.Join(groups, " "), amount%100)
+}
+
+func formatSignedMoney(amount int64) string {
+	if amount > 0 {
+		return "+" + formatMoney(amount)
+	}
+	return formatMoney(amount)
+}
+
+func formatDelta(current int64, previous int64) string {
+	if previous == 0 {
+		return NewCategoryDelta
+	}
+	return fmt.Sprintf("%+.0f%%", float64(current-previous)*100/float64(previous))
+}
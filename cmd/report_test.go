@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDelta(t *testing.T) {
+	tests := []struct {
+		current  int64
+		previous int64
+		want     string
+	}{
+		{15000, 10000, "+50%"},
+		{5000, 10000, "-50%"},
+		{0, 10000, "-100%"},
+		{10000, 0, NewCategoryDelta},
+	}
+	for _, tt := range tests {
+		if got := formatDelta(tt.current, tt.previous); got != tt.want {
+			t.Errorf("formatDelta(%d, %d) = %q, want %q", tt.current, tt.previous, got, tt.want)
+		}
+	}
+}
+
+func TestFormatReportPreviousOnlyCategory(t *testing.T) {
+	period, err := parsePeriod("", time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := []CategoryTotal{{Category: "еда", AmountRub: 20000, AmountUsd: 250}}
+	previous := []CategoryTotal{{Category: "еда", AmountRub: 10000}, {Category: "такси", AmountRub: 5000}}
+	report := formatReport(period, period.Previous(), ReportFilter{}, current, previous, nil)
+	for _, line := range strings.Split(report, "\n") {
+		if strings.Contains(line, "такси") {
+			if !strings.Contains(line, "-100%") {
+				t.Errorf("такси row = %q, want -100%%", line)
+			}
+			return
+		}
+	}
+	t.Errorf("no такси row in\n%s", report)
+}
@@ -2,20 +2,86 @@ package main
 
 import (
 	"context"
+	"errors"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/konstantin-yakimenko/home-budget-bot/export"
 	"math/big"
+	"strings"
+	"time"
 )
 
 const (
-	UserSelect     = "SELECT id FROM users WHERE user_name = $1"
-	UserInsert     = "INSERT INTO users(user_name, first_name, last_name, lang) VALUES ($1, $2, $3, $4) RETURNING id"
-	BillInsert     = "INSERT INTO bills(user_id, bought_at, description, category, amount, currency, amount_rub, amount_usd) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
-	BillItemInsert = "INSERT INTO bill_items(bill_id, title, price, cnt, amount, currency, amount_rub, amount_usd) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	UserClaim      = "UPDATE users SET telegram_id = $1 WHERE id = (SELECT id FROM users WHERE user_name = $2 AND user_name <> '' AND telegram_id IS NULL ORDER BY id LIMIT 1) AND NOT EXISTS (SELECT 1 FROM users WHERE telegram_id = $1) RETURNING id"
+	UserUpsert     = "INSERT INTO users(telegram_id, user_name, first_name, last_name, lang) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (telegram_id) DO UPDATE SET user_name = EXCLUDED.user_name, first_name = EXCLUDED.first_name, last_name = EXCLUDED.last_name, lang = EXCLUDED.lang RETURNING id"
+	LedgerUpsert   = "INSERT INTO ledgers(chat_id, title) VALUES ($1, $2) ON CONFLICT (chat_id) DO UPDATE SET title = EXCLUDED.title RETURNING id"
+	LedgerAssign   = "UPDATE bills SET ledger_id = $2 WHERE user_id = $1 AND ledger_id IS NULL"
+	MerchantUpsert = "INSERT INTO merchants(pib, name, company, address, municipality) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (pib, name) DO UPDATE SET company = EXCLUDED.company, address = EXCLUDED.address, municipality = EXCLUDED.municipality RETURNING id"
+	BillInsert     = "INSERT INTO bills(user_id, ledger_id, bought_at, description, category, amount, currency, amount_rub, amount_usd, note, amount_expression, invoice_number, invoice_counter, merchant_id, cashier, payment_method) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''), $14, NULLIF($15, ''), NULLIF($16, '')) RETURNING id"
+	BillItemInsert = "INSERT INTO bill_items(bill_id, title, price, cnt, amount, currency, amount_rub, amount_usd, category) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))"
 	CategorySelect = "SELECT category FROM desc_categories WHERE description = $1"
+	BillTagInsert  = "INSERT INTO bill_tags(bill_id, tag) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	BillTagsDelete = "DELETE FROM bill_tags WHERE bill_id = $1"
+	CurrencySelect = "SELECT id, code, title, aliases FROM currencies ORDER BY id"
+
+	MerchantCategorySelect = "SELECT category FROM merchant_categories WHERE pib = $1 OR strpos(lower($2), name_pattern) > 0 OR strpos(lower($3), name_pattern) > 0 ORDER BY pib IS NULL, length(name_pattern) DESC LIMIT 1"
+	MerchantRulesSelect    = "SELECT COALESCE(pib, ''), COALESCE(name_pattern, ''), category FROM merchant_categories ORDER BY pib, name_pattern"
+	MerchantPibRuleUpsert  = "INSERT INTO merchant_categories(pib, category) VALUES ($1, $2) ON CONFLICT (pib) DO UPDATE SET category = EXCLUDED.category"
+	MerchantNameRuleUpsert = "INSERT INTO merchant_categories(name_pattern, category) VALUES ($1, $2) ON CONFLICT (name_pattern) DO UPDATE SET category = EXCLUDED.category"
+	MerchantRuleDelete     = "DELETE FROM merchant_categories WHERE pib = $1 OR name_pattern = $2"
+	BillMerchantPibSelect  = "SELECT COALESCE(m.pib, '') FROM bills b LEFT JOIN merchants m ON m.id = b.merchant_id WHERE b.id = $1"
+
+	ItemRulesSelect = "SELECT pattern, category FROM item_categories ORDER BY created_at, pattern"
+	ItemRuleUpsert  = "INSERT INTO item_categories(pattern, category) VALUES ($1, $2) ON CONFLICT (pattern) DO UPDATE SET category = EXCLUDED.category"
+	ItemRuleDelete  = "DELETE FROM item_categories WHERE pattern = $1"
+
+	CategoriesSelect   = "SELECT DISTINCT category FROM desc_categories ORDER BY category"
+	CategoryUpsert     = "INSERT INTO desc_categories(description, category) VALUES ($1, $2) ON CONFLICT (description) DO UPDATE SET category = EXCLUDED.category"
+	CategoryDelete     = "DELETE FROM desc_categories WHERE description = $1"
+	MappingsSelect     = "SELECT description, category FROM desc_categories ORDER BY category, description"
+	MappingsRename     = "UPDATE desc_categories SET category = $2 WHERE category = $1"
+	BillsRename        = "UPDATE bills SET category = $2 WHERE category = $1"
+	BillItemsRename    = "UPDATE bill_items SET category = $2 WHERE category = $1"
+	MerchantsRename    = "UPDATE merchant_categories SET category = $2 WHERE category = $1"
+	ItemsRename        = "UPDATE item_categories SET category = $2 WHERE category = $1"
+	BillCategorySelect = "SELECT COALESCE(b.description, ''), COALESCE(b.category, '-') FROM bills b JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $1 AND b.id = $2"
+	BillCategoryUpdate = "UPDATE bills SET category = $3 WHERE id = $2 AND ledger_id = (SELECT id FROM ledgers WHERE chat_id = $1)"
+
+	BillMessageInsert   = "INSERT INTO bill_messages(chat_id, message_id, bill_id, line_no) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING"
+	BillByMessageSelect = "SELECT line_no, bill_id FROM bill_messages WHERE chat_id = $1 AND message_id = $2"
+	LastUserBillSelect  = "SELECT b.id FROM bills b JOIN users u ON u.id = b.user_id JOIN ledgers l ON l.id = b.ledger_id WHERE u.telegram_id = $1 AND l.chat_id = $2 ORDER BY b.created_at DESC, b.id DESC LIMIT 1"
+	BillMessagesDelete  = "DELETE FROM bill_messages WHERE bill_id = $1"
+	BillMessagesMove    = "UPDATE bill_messages SET line_no = $2 WHERE bill_id = $1 AND line_no = 0"
+	BillItemsDelete     = "DELETE FROM bill_items WHERE bill_id = $1"
+	BillDelete          = "DELETE FROM bills WHERE id = $1"
+	BillEditedSelect    = "SELECT bought_at, COALESCE(description, ''), COALESCE(category, '-') FROM bills WHERE id = $1"
+	BillByInvoiceSelect = "SELECT b.id, b.bought_at, b.amount, c.code FROM bills b JOIN currencies c ON c.id = b.currency JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $1 AND b.invoice_number = $2"
+	BillUpdate          = "UPDATE bills SET description = $2, category = $3, amount = $4, currency = $5, amount_rub = $6, amount_usd = $7, note = $8, bought_at = $9, amount_expression = $10 WHERE id = $1"
+
+	MembersSelect = "SELECT telegram_id, is_admin FROM members"
+	AdminUpsert   = "INSERT INTO members(telegram_id, is_admin) VALUES ($1, true) ON CONFLICT (telegram_id) DO UPDATE SET is_admin = true"
+	AdminsDemote  = "UPDATE members SET is_admin = false WHERE is_admin AND telegram_id <> ALL($1)"
+	MemberInsert  = "INSERT INTO members(telegram_id, invited_by) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	MemberDelete  = "DELETE FROM members WHERE telegram_id = $1 AND NOT is_admin"
+	InviteInsert  = "INSERT INTO invites(code, created_by) VALUES ($1, $2)"
+	InviteRedeem  = "UPDATE invites SET used_by = $2, used_at = CURRENT_TIMESTAMP WHERE code = $1 AND used_by IS NULL AND created_at > $3 RETURNING created_by"
+
+	ExportBillsSelect    = "SELECT b.id, b.bought_at, COALESCE(b.category, '-'), COALESCE(b.description, ''), COALESCE(NULLIF(u.first_name, ''), u.user_name), b.amount_rub, b.amount_usd FROM bills b JOIN users u ON u.id = b.user_id JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $1 AND b.bought_at >= $2 AND b.bought_at < $3 ORDER BY b.bought_at, b.id"
+	ExportItemsSelect    = "SELECT b.id, b.bought_at, COALESCE(b.description, ''), COALESCE(i.title, ''), COALESCE(i.category, b.category, '-'), i.amount_rub, i.amount_usd FROM bill_items i JOIN bills b ON b.id = i.bill_id JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $1 AND b.bought_at >= $2 AND b.bought_at < $3 AND EXISTS (SELECT 1 FROM bill_items c WHERE c.bill_id = b.id AND c.category IS NOT NULL) ORDER BY b.bought_at, b.id, i.id"
+	CategoryTotalsSelect = "SELECT a.category, SUM(a.amount_rub)::bigint, SUM(a.amount_usd)::bigint FROM bill_amounts a JOIN bills b ON b.id = a.bill_id JOIN users u ON u.id = b.user_id JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $5 AND b.bought_at >= $1 AND b.bought_at < $2 AND ($3::bigint = 0 OR u.telegram_id = $3) AND (cardinality($4::text[]) = 0 OR EXISTS (SELECT 1 FROM bill_tags t WHERE t.bill_id = b.id AND t.tag = ANY($4))) GROUP BY 1"
+	PayerTotalsSelect    = "SELECT COALESCE(NULLIF(u.first_name, ''), u.user_name), SUM(b.amount_rub)::bigint, SUM(b.amount_usd)::bigint FROM bills b JOIN users u ON u.id = b.user_id JOIN ledgers l ON l.id = b.ledger_id WHERE l.chat_id = $5 AND b.bought_at >= $1 AND b.bought_at < $2 AND ($3::bigint = 0 OR u.telegram_id = $3) AND (cardinality($4::text[]) = 0 OR EXISTS (SELECT 1 FROM bill_tags t WHERE t.bill_id = b.id AND t.tag = ANY($4))) GROUP BY u.id, 1 ORDER BY 2 DESC"
 )
 
+const UnknownCategory = "-"
+
+// uniqueViolation is the postgres error code of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// ErrBillExists is returned when a fiscal receipt with the same invoice number is already saved in the ledger.
+var ErrBillExists = errors.New("bill already exists")
+
 type Repository struct {
 	pool *pgxpool.Pool
 }
@@ -37,12 +103,85 @@ func (r *Repository) GetCategoryByDescription(ctx context.Context, description s
 			return "", err
 		}
 	} else {
-		category = "-"
+		category = UnknownCategory
 	}
 	return category, nil
 }
 
-func (r *Repository) SaveBill(ctx context.Context, user *tgbotapi.User, bill *Bill, currency *Currency, usd *Currency) error {
+func (r *Repository) GetCurrencies(ctx context.Context) ([]CurrencyInfo, error) {
+	rows, err := r.pool.Query(ctx, CurrencySelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var currencies []CurrencyInfo
+	for rows.Next() {
+		var currency CurrencyInfo
+		err = rows.Scan(&currency.NumCode, &currency.Code, &currency.Title, &currency.Aliases)
+		if err != nil {
+			return nil, err
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, rows.Err()
+}
+
+func (r *Repository) GetCategories(ctx context.Context) ([]string, error) {
+	rows, err := r.pool.Query(ctx, CategoriesSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var category string
+		err = rows.Scan(&category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+func (r *Repository) SaveCategory(ctx context.Context, description string, category string) error {
+	_, err := r.pool.Exec(ctx, CategoryUpsert, description, category)
+	return err
+}
+
+func (r *Repository) DeleteCategory(ctx context.Context, description string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, CategoryDelete, description)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Repository) GetCategoryMappings(ctx context.Context) ([]CategoryMapping, error) {
+	rows, err := r.pool.Query(ctx, MappingsSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []CategoryMapping
+	for rows.Next() {
+		var mapping CategoryMapping
+		err = rows.Scan(&mapping.Description, &mapping.Category)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+// RenameCategory renames the category in the description mappings, merchant and item rules and,
+// if withBills is set, in already saved bills and their items. It returns the number of changed mappings and rules
+// and the number of changed bills and items.
+func (r *Repository) RenameCategory(ctx context.Context, oldName string, newName string, withBills bool) (int64, int64, error) {
 	tx, err := r.pool.BeginTx(
 		ctx,
 		pgx.TxOptions{
@@ -50,60 +189,650 @@ func (r *Repository) SaveBill(ctx context.Context, user *tgbotapi.User, bill *Bi
 			AccessMode:     pgx.ReadWrite,
 			DeferrableMode: pgx.Deferrable})
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
-	var userId int64
-	users, err := tx.Query(ctx, UserSelect, user.UserName)
+	mappings, err := execAll(ctx, tx, []string{MappingsRename, MerchantsRename, ItemsRename}, oldName, newName)
 	if err != nil {
 		_ = tx.Rollback(ctx)
-		return err
+		return 0, 0, err
 	}
-	if users.Next() {
-		err = users.Scan(&userId)
+	var bills int64
+	if withBills {
+		bills, err = execAll(ctx, tx, []string{BillsRename, BillItemsRename}, oldName, newName)
 		if err != nil {
 			_ = tx.Rollback(ctx)
-			return err
+			return 0, 0, err
 		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return mappings, bills, nil
+}
+
+// execAll runs the queries with the same arguments and returns the total number of changed rows.
+func execAll(ctx context.Context, tx pgx.Tx, queries []string, args ...interface{}) (int64, error) {
+	var count int64
+	for _, query := range queries {
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		count += tag.RowsAffected()
+	}
+	return count, nil
+}
+
+// GetChatBill returns the description and category of the bill in the ledger of the chat or nil if it is not there.
+func (r *Repository) GetChatBill(ctx context.Context, chatId int64, billId int64) (*Bill, error) {
+	var bill Bill
+	err := r.pool.QueryRow(ctx, BillCategorySelect, chatId, billId).Scan(&bill.Description, &bill.Category)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bill, nil
+}
+
+func (r *Repository) SetBillCategory(ctx context.Context, chatId int64, billId int64, category string) error {
+	_, err := r.pool.Exec(ctx, BillCategoryUpdate, chatId, billId, category)
+	return err
+}
+
+func (r *Repository) SaveBill(ctx context.Context, user *tgbotapi.User, chat *tgbotapi.Chat, bill *Bill, currency *Currency, usd *Currency) (int64, error) {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return 0, err
+	}
+
+	userId, err := getUserId(ctx, tx, user)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return 0, err
+	}
+	ledgerId, err := getLedgerId(ctx, tx, chat)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return 0, err
+	}
+
+	billId, err := insertBill(ctx, tx, userId, ledgerId, bill, currency, usd)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return billId, nil
+}
+
+// SaveBills saves the bills in one transaction. A bill that fails to save is rolled back to its savepoint
+// and gets Err set, the other bills are saved anyway. It returns the ids in the order of the bills, 0 for the failed ones.
+func (r *Repository) SaveBills(ctx context.Context, user *tgbotapi.User, chat *tgbotapi.Chat, bills []*PreparedBill) ([]int64, error) {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return nil, err
+	}
+
+	userId, err := getUserId(ctx, tx, user)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+	ledgerId, err := getLedgerId(ctx, tx, chat)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return nil, err
+	}
+
+	billIds := make([]int64, len(bills))
+	for i, bill := range bills {
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+		billIds[i], bill.Err = insertBill(ctx, savepoint, userId, ledgerId, bill.Bill, bill.Currency, bill.Usd)
+		if bill.Err != nil {
+			err = savepoint.Rollback(ctx)
+		} else {
+			err = savepoint.Commit(ctx)
+		}
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return billIds, nil
+}
+
+// SaveUser creates the user or updates the name and the language, it returns the id of the user.
+func (r *Repository) SaveUser(ctx context.Context, user *tgbotapi.User) (int64, error) {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return 0, err
+	}
+	userId, err := getUserId(ctx, tx, user)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return 0, err
+	}
+	return userId, tx.Commit(ctx)
+}
+
+// getUserId finds the user by telegram id. The users saved before telegram ids were stored are found by user_name once,
+// see migrations/007_users_telegram_id.sql.
+// The bills of a claimed user that have no ledger go to the personal one, see migrations/008_ledgers.sql.
+func getUserId(ctx context.Context, tx pgx.Tx, user *tgbotapi.User) (int64, error) {
+	var userId int64
+	err := tx.QueryRow(ctx, UserClaim, user.ID, user.UserName).Scan(&userId)
+	if err == nil {
+		err = assignLedger(ctx, tx, user, userId)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	err = tx.QueryRow(ctx, UserUpsert, user.ID, user.UserName, user.FirstName, user.LastName, user.LanguageCode).Scan(&userId)
+	return userId, err
+}
+
+// assignLedger puts the bills of the user saved before ledgers into the ledger of the private chat with the user.
+func assignLedger(ctx context.Context, tx pgx.Tx, user *tgbotapi.User, userId int64) error {
+	ledgerId, err := getLedgerId(ctx, tx, &tgbotapi.Chat{ID: user.ID, Type: "private", FirstName: user.FirstName, LastName: user.LastName})
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, LedgerAssign, userId, ledgerId)
+	return err
+}
+
+// getLedgerId returns the ledger of the chat: shared for a group, personal for a private chat.
+func getLedgerId(ctx context.Context, tx pgx.Tx, chat *tgbotapi.Chat) (int64, error) {
+	title := chat.Title
+	if chat.IsPrivate() {
+		title = strings.TrimSpace(chat.FirstName + " " + chat.LastName)
+	}
+	var ledgerId int64
+	err := tx.QueryRow(ctx, LedgerUpsert, chat.ID, title).Scan(&ledgerId)
+	return ledgerId, err
+}
+
+// GetMerchantCategory returns the category of the matching merchant rule or an empty string if there is none.
+func (r *Repository) GetMerchantCategory(ctx context.Context, merchant *Merchant) (string, error) {
+	var category string
+	err := r.pool.QueryRow(ctx, MerchantCategorySelect, merchant.Pib, merchant.Name, merchant.Company).Scan(&category)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return category, err
+}
+
+func (r *Repository) GetMerchantRules(ctx context.Context) ([]MerchantRule, error) {
+	rows, err := r.pool.Query(ctx, MerchantRulesSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []MerchantRule
+	for rows.Next() {
+		var rule MerchantRule
+		err = rows.Scan(&rule.Pib, &rule.NamePattern, &rule.Category)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *Repository) SaveMerchantRule(ctx context.Context, rule MerchantRule) error {
+	var err error
+	if rule.Pib != "" {
+		_, err = r.pool.Exec(ctx, MerchantPibRuleUpsert, rule.Pib, rule.Category)
 	} else {
-		err := tx.QueryRow(ctx, UserInsert, user.UserName, user.FirstName, user.LastName, user.LanguageCode).Scan(&userId)
+		_, err = r.pool.Exec(ctx, MerchantNameRuleUpsert, rule.NamePattern, rule.Category)
+	}
+	return err
+}
+
+func (r *Repository) DeleteMerchantRule(ctx context.Context, rule MerchantRule) (bool, error) {
+	tag, err := r.pool.Exec(ctx, MerchantRuleDelete, rule.Pib, rule.NamePattern)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetItemRules returns the item rules in the order they were added, the first matching one wins.
+func (r *Repository) GetItemRules(ctx context.Context) ([]ItemRule, error) {
+	rows, err := r.pool.Query(ctx, ItemRulesSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []ItemRule
+	for rows.Next() {
+		var rule ItemRule
+		err = rows.Scan(&rule.Pattern, &rule.Category)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *Repository) SaveItemRule(ctx context.Context, rule ItemRule) error {
+	_, err := r.pool.Exec(ctx, ItemRuleUpsert, rule.Pattern, rule.Category)
+	return err
+}
+
+func (r *Repository) DeleteItemRule(ctx context.Context, pattern string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, ItemRuleDelete, pattern)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetBillMerchantPib returns the PIB of the bill saved from a fiscal receipt or an empty string.
+func (r *Repository) GetBillMerchantPib(ctx context.Context, billId int64) (string, error) {
+	var pib string
+	err := r.pool.QueryRow(ctx, BillMerchantPibSelect, billId).Scan(&pib)
+	return pib, err
+}
+
+// getMerchantId saves the merchant or updates its address, a merchant is a point of sale of the company with the PIB.
+func getMerchantId(ctx context.Context, tx pgx.Tx, merchant *Merchant) (int64, error) {
+	var merchantId int64
+	err := tx.QueryRow(ctx, MerchantUpsert, merchant.Pib, merchant.Name, merchant.Company, merchant.Address, merchant.Municipality).Scan(&merchantId)
+	return merchantId, err
+}
+
+func insertBill(ctx context.Context, tx pgx.Tx, userId int64, ledgerId int64, bill *Bill, currency *Currency, usd *Currency) (int64, error) {
+	var merchantId *int64
+	if bill.Merchant != nil {
+		id, err := getMerchantId(ctx, tx, bill.Merchant)
+		if err != nil {
+			return 0, err
+		}
+		merchantId = &id
+	}
+
+	rubAmount := convertToRub(bill.TotalAmount, currency)
+	usdAmount := convertToUsd(bill.TotalAmount, currency, usd)
+	var billId int64
+	err := tx.QueryRow(ctx, BillInsert, userId, ledgerId, bill.BoughtAt, bill.Description, bill.Category, bill.TotalAmount, currency.NumCode, rubAmount, usdAmount, bill.Note, bill.Expression,
+		bill.InvoiceNumber, bill.InvoiceCounter, merchantId, bill.Cashier, bill.PaymentMethod).Scan(&billId)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "idx_bills_ledger_invoice" {
+		return 0, ErrBillExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tag := range bill.Tags {
+		_, err = tx.Exec(ctx, BillTagInsert, billId, tag)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, item := range bill.Items {
+		rubAmountItem := convertToRub(item.Sum, currency)
+		usdAmountItem := convertToUsd(item.Sum, currency, usd)
+		_, err = tx.Exec(ctx, BillItemInsert, billId, item.Name, item.Price, item.Count, item.Sum, currency.NumCode, rubAmountItem, usdAmountItem, item.Category)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return billId, nil
+}
+
+// SaveBillMessages links telegram messages (the user's one and the bot's reply) to the saved bill.
+// The line is the number of the bill's line in a multi-line message starting from 1, or 0 for a single bill.
+func (r *Repository) SaveBillMessages(ctx context.Context, billId int64, line int, chatId int64, messageIds ...int) error {
+	for _, messageId := range messageIds {
+		if messageId == 0 {
+			continue
+		}
+		_, err := r.pool.Exec(ctx, BillMessageInsert, chatId, messageId, billId, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveBillMessagesToLine links the messages of a single bill to it as to the bill of the line, see SaveBillMessages.
+func (r *Repository) MoveBillMessagesToLine(ctx context.Context, billId int64, line int) error {
+	_, err := r.pool.Exec(ctx, BillMessagesMove, billId, line)
+	return err
+}
+
+// GetMessageBills returns the bills linked to the message by their line, see SaveBillMessages.
+func (r *Repository) GetMessageBills(ctx context.Context, chatId int64, messageId int) (map[int]int64, error) {
+	rows, err := r.pool.Query(ctx, BillByMessageSelect, chatId, messageId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bills := map[int]int64{}
+	for rows.Next() {
+		var line int
+		var billId int64
+		if err := rows.Scan(&line, &billId); err != nil {
+			return nil, err
+		}
+		bills[line] = billId
+	}
+	return bills, rows.Err()
+}
+
+// GetLastBillId returns the most recently saved bill of the user or 0 if there is none.
+func (r *Repository) GetLastBillId(ctx context.Context, user *tgbotapi.User, chatId int64) (int64, error) {
+	var billId int64
+	err := r.pool.QueryRow(ctx, LastUserBillSelect, user.ID, chatId).Scan(&billId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return billId, err
+}
+
+func (r *Repository) DeleteBill(ctx context.Context, billId int64) error {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return err
+	}
+
+	for _, query := range []string{BillMessagesDelete, BillTagsDelete, BillItemsDelete, BillDelete} {
+		_, err = tx.Exec(ctx, query, billId)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return err
 		}
 	}
-	users.Close()
+
+	return tx.Commit(ctx)
+}
+
+// GetCategoryTotals sums bills by category for [from, to). An empty filter means bills of all users with any tags.
+func (r *Repository) GetCategoryTotals(ctx context.Context, from time.Time, to time.Time, filter ReportFilter) ([]CategoryTotal, error) {
+	tags := filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	rows, err := r.pool.Query(ctx, CategoryTotalsSelect, from, to, filter.TelegramId, tags, filter.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []CategoryTotal
+	for rows.Next() {
+		var total CategoryTotal
+		err = rows.Scan(&total.Category, &total.AmountRub, &total.AmountUsd)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+// GetPayerTotals sums the bills of the report by the users who paid them.
+func (r *Repository) GetPayerTotals(ctx context.Context, from time.Time, to time.Time, filter ReportFilter) ([]PayerTotal, error) {
+	tags := filter.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	rows, err := r.pool.Query(ctx, PayerTotalsSelect, from, to, filter.TelegramId, tags, filter.ChatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []PayerTotal
+	for rows.Next() {
+		var total PayerTotal
+		err = rows.Scan(&total.Name, &total.AmountRub, &total.AmountUsd)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
+
+func (r *Repository) GetBillsForExport(ctx context.Context, chatId int64, from time.Time, to time.Time) ([]export.Bill, error) {
+	rows, err := r.pool.Query(ctx, ExportBillsSelect, chatId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bills []export.Bill
+	for rows.Next() {
+		var bill export.Bill
+		err = rows.Scan(&bill.Id, &bill.BoughtAt, &bill.Category, &bill.Description, &bill.PaidBy, &bill.AmountRub, &bill.AmountUsd)
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, bill)
+	}
+	return bills, rows.Err()
+}
+
+// GetItemsForExport returns the items of the bills that have item categories, see the bill_amounts view.
+func (r *Repository) GetItemsForExport(ctx context.Context, chatId int64, from time.Time, to time.Time) ([]export.Item, error) {
+	rows, err := r.pool.Query(ctx, ExportItemsSelect, chatId, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []export.Item
+	for rows.Next() {
+		var item export.Item
+		err = rows.Scan(&item.BillId, &item.BoughtAt, &item.Description, &item.Name, &item.Category, &item.AmountRub, &item.AmountUsd)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetBillByInvoice returns the bill saved from the fiscal receipt in the ledger of the chat or nil if there is none.
+func (r *Repository) GetBillByInvoice(ctx context.Context, chatId int64, invoiceNumber string) (*SavedBill, error) {
+	var bill SavedBill
+	err := r.pool.QueryRow(ctx, BillByInvoiceSelect, chatId, invoiceNumber).Scan(&bill.Id, &bill.BoughtAt, &bill.Amount, &bill.Currency)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bill, nil
+}
+
+// GetEditedBill returns the date, description and category of the saved bill whose message is edited.
+func (r *Repository) GetEditedBill(ctx context.Context, billId int64) (*Bill, error) {
+	var bill Bill
+	err := r.pool.QueryRow(ctx, BillEditedSelect, billId).Scan(&bill.BoughtAt, &bill.Description, &bill.Category)
+	if err != nil {
+		return nil, err
+	}
+	return &bill, nil
+}
+
+func (r *Repository) UpdateBill(ctx context.Context, billId int64, bill *Bill, currency *Currency, usd *Currency) error {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return err
+	}
 
 	rubAmount := convertToRub(bill.TotalAmount, currency)
 	usdAmount := convertToUsd(bill.TotalAmount, currency, usd)
-	var billId int64
-	rows, err := tx.Query(ctx, BillInsert, userId, bill.BoughtAt, bill.Description, bill.Category, bill.TotalAmount, currency.NumCode, rubAmount, usdAmount)
+	_, err = tx.Exec(ctx, BillUpdate, billId, bill.Description, bill.Category, bill.TotalAmount, currency.NumCode, rubAmount, usdAmount, bill.Note, bill.BoughtAt, bill.Expression)
 	if err != nil {
 		_ = tx.Rollback(ctx)
 		return err
 	}
-	rows.Next()
-	err = rows.Scan(&billId)
+
+	_, err = tx.Exec(ctx, BillTagsDelete, billId)
 	if err != nil {
 		_ = tx.Rollback(ctx)
 		return err
 	}
-	rows.Close()
+	for _, tag := range bill.Tags {
+		_, err = tx.Exec(ctx, BillTagInsert, billId, tag)
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+	}
 
-	for _, item := range bill.Items {
-		rubAmountItem := convertToRub(item.Sum, currency)
-		usdAmountItem := convertToUsd(item.Sum, currency, usd)
-		_, err = tx.Exec(ctx, BillItemInsert, billId, item.Name, item.Price, item.Count, item.Sum, currency.NumCode, rubAmountItem, usdAmountItem)
+	return tx.Commit(ctx)
+}
+
+// GetMembers returns the telegram ids of the users allowed to use the bot, true for admins.
+func (r *Repository) GetMembers(ctx context.Context) (map[int64]bool, error) {
+	rows, err := r.pool.Query(ctx, MembersSelect)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[int64]bool)
+	for rows.Next() {
+		var telegramId int64
+		var isAdmin bool
+		err = rows.Scan(&telegramId, &isAdmin)
+		if err != nil {
+			return nil, err
+		}
+		members[telegramId] = isAdmin
+	}
+	return members, rows.Err()
+}
+
+// SaveAdmins makes the users admins, the admins not among them stay members only.
+func (r *Repository) SaveAdmins(ctx context.Context, telegramIds []int64) error {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return err
+	}
+
+	if telegramIds == nil {
+		telegramIds = []int64{}
+	}
+	_, err = tx.Exec(ctx, AdminsDemote, telegramIds)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return err
+	}
+	for _, telegramId := range telegramIds {
+		_, err = tx.Exec(ctx, AdminUpsert, telegramId)
 		if err != nil {
 			_ = tx.Rollback(ctx)
 			return err
 		}
 	}
+	return tx.Commit(ctx)
+}
 
-	err = tx.Commit(ctx)
+// DeleteMember removes the user from the allow-list. Admins can't be removed, false means there was no such member.
+func (r *Repository) DeleteMember(ctx context.Context, telegramId int64) (bool, error) {
+	tag, err := r.pool.Exec(ctx, MemberDelete, telegramId)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *Repository) SaveInvite(ctx context.Context, code string, createdBy int64) error {
+	_, err := r.pool.Exec(ctx, InviteInsert, code, createdBy)
 	return err
 }
 
+// RedeemInvite marks the invite created after createdAfter as used and adds the user to the members.
+// It returns false if there is no such invite or it has been used already.
+func (r *Repository) RedeemInvite(ctx context.Context, code string, telegramId int64, createdAfter time.Time) (bool, error) {
+	tx, err := r.pool.BeginTx(
+		ctx,
+		pgx.TxOptions{
+			IsoLevel:       pgx.ReadCommitted,
+			AccessMode:     pgx.ReadWrite,
+			DeferrableMode: pgx.Deferrable})
+	if err != nil {
+		return false, err
+	}
+
+	var createdBy int64
+	err = tx.QueryRow(ctx, InviteRedeem, code, telegramId, createdAfter).Scan(&createdBy)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	_, err = tx.Exec(ctx, MemberInsert, telegramId, createdBy)
+	if err != nil {
+		_ = tx.Rollback(ctx)
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
+
 func convertToUsd(amount int64, currency *Currency, usd *Currency) int64 {
 	if currency.Code == "USD" {
 		return amount
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"os"
+	"testing"
+	"time"
+)
+
+// testRepository creates the tables of ddl.sql in a schema of its own in the database of PG_HOMEBUDGET_TEST_DB,
+// the test is skipped without it.
+func testRepository(t *testing.T) *Repository {
+	url := os.Getenv("PG_HOMEBUDGET_TEST_DB")
+	if url == "" {
+		t.Skip("PG_HOMEBUDGET_TEST_DB is not set")
+	}
+	ddl, err := os.ReadFile("../ddl.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	pool, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = pool.Exec(ctx, "DROP SCHEMA IF EXISTS "+schema+" CASCADE")
+		pool.Close()
+	})
+	if _, err = pool.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.Exec(ctx, string(ddl)); err != nil {
+		t.Fatal(err)
+	}
+	return NewRepository(pool)
+}
+
+func TestBillBeforeLedgersInReport(t *testing.T) {
+	r := testRepository(t)
+	ctx := context.Background()
+
+	// the bill of a user known by user_name only, left without a ledger by migrations/008_ledgers.sql
+	var userId int64
+	if err := r.pool.QueryRow(ctx, "INSERT INTO users(user_name) VALUES ('anna') RETURNING id").Scan(&userId); err != nil {
+		t.Fatal(err)
+	}
+	_, err := r.pool.Exec(ctx, "INSERT INTO bills(user_id, bought_at, description, category, amount, currency, amount_rub, amount_usd) VALUES ($1, '2023-01-10', 'хлеб', 'еда', 10000, 643, 10000, 130)", userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = r.SaveUser(ctx, &tgbotapi.User{ID: 42, UserName: "anna", FirstName: "Аня"}); err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	totals, err := r.GetCategoryTotals(ctx, from, from.AddDate(0, 1, 0), ReportFilter{ChatId: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].Category != "еда" || totals[0].AmountRub != 10000 {
+		t.Errorf("totals = %v, want the bill saved before ledgers", totals)
+	}
+}
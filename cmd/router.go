@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"strings"
+)
+
+// MessageHandler handles a message or a command.
+type MessageHandler func(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message)
+
+// CallbackHandler handles a press on an inline keyboard button.
+type CallbackHandler func(ctx context.Context, bot *tgbotapi.BotAPI, query *tgbotapi.CallbackQuery)
+
+type messageRoute struct {
+	match  func(message *tgbotapi.Message) bool
+	handle MessageHandler
+}
+
+// router passes an update to the handler registered for it.
+type router struct {
+	commands       map[string]MessageHandler
+	menu           []tgbotapi.BotCommand
+	unknownCommand MessageHandler
+	messages       []messageRoute
+	edited         MessageHandler
+	callback       CallbackHandler
+}
+
+func newRouter(unknownCommand MessageHandler) *router {
+	return &router{
+		commands:       make(map[string]MessageHandler),
+		unknownCommand: unknownCommand,
+	}
+}
+
+// Command registers a handler for the command. The commands with a description are listed in /help
+// and in the bot menu in the order they were registered.
+func (r *router) Command(command string, description string, handle MessageHandler) {
+	r.commands[command] = handle
+	if description != "" {
+		r.menu = append(r.menu, tgbotapi.BotCommand{Command: command, Description: description})
+	}
+}
+
+// BotCommands returns the command list for setMyCommands.
+func (r *router) BotCommands() []tgbotapi.BotCommand {
+	return r.menu
+}
+
+func (r *router) Help() string {
+	var sb strings.Builder
+	sb.WriteString(HelpIntro)
+	for _, command := range r.menu {
+		sb.WriteString(fmt.Sprintf("\n/%s — %s", command.Command, command.Description))
+	}
+	return sb.String()
+}
+
+// Message registers a handler for the messages that are not commands. The routes are tried in the order
+// they were registered, the first matching one handles the message, nil match accepts any message.
+func (r *router) Message(match func(message *tgbotapi.Message) bool, handle MessageHandler) {
+	r.messages = append(r.messages, messageRoute{match: match, handle: handle})
+}
+
+func (r *router) EditedMessage(handle MessageHandler) {
+	r.edited = handle
+}
+
+func (r *router) Callback(handle CallbackHandler) {
+	r.callback = handle
+}
+
+func (r *router) Handle(ctx context.Context, bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	switch {
+	case update.Message != nil:
+		log.Ctx(ctx).Info().Msg(update.Message.Text)
+		r.handleMessage(ctx, bot, update.Message)
+	case update.EditedMessage != nil && r.edited != nil:
+		log.Ctx(ctx).Info().Msgf("edited: %s", update.EditedMessage.Text)
+		r.edited(ctx, bot, update.EditedMessage)
+	case update.CallbackQuery != nil && r.callback != nil:
+		log.Ctx(ctx).Info().Msgf("callback: %s", update.CallbackQuery.Data)
+		r.callback(ctx, bot, update.CallbackQuery)
+	}
+}
+
+func (r *router) handleMessage(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	if message.IsCommand() {
+		handle, ok := r.commands[message.Command()]
+		if !ok {
+			handle = r.unknownCommand
+		}
+		handle(ctx, bot, message)
+		return
+	}
+	for _, route := range r.messages {
+		if route.match == nil || route.match(message) {
+			route.handle(ctx, bot, message)
+			return
+		}
+	}
+}
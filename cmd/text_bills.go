@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"strings"
+	"time"
+)
+
+const (
+	LineSaved  = "✓ %s → %s"
+	LineFailed = "✗ %s: %s"
+	LinesSaved = "Сохранено %d из %d"
+)
+
+// entryLines splits a message into non-empty lines, one expense per line.
+func entryLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func isMultiLine(message *tgbotapi.Message) bool {
+	return len(entryLines(message.Text)) > 1
+}
+
+// editedLines returns the bills of the edited message by line and true if the text is to be applied line by line.
+// A single bill edited into several lines becomes the bill of the first line.
+func editedLines(bills map[int]int64, text string) (map[int]int64, bool) {
+	billId, ok := bills[0]
+	if !ok {
+		return bills, true
+	}
+	if len(entryLines(text)) > 1 {
+		return map[int]int64{1: billId}, true
+	}
+	return bills, false
+}
+
+// handleTextBills saves every line of the message as a separate bill and replies with a summary per line.
+func (a *app) handleTextBills(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message) {
+	sentAt := time.Unix(int64(message.Date), 0)
+	var bills []*PreparedBill
+	for _, line := range entryLines(message.Text) {
+		bills = append(bills, a.prepareTextBill(ctx, line, sentAt))
+	}
+	if !a.saveTextBills(ctx, bot, message, bills) {
+		return
+	}
+	a.replyTextBills(ctx, bot, message, bills)
+}
+
+// updateTextBills applies the edited multi-line message line by line: the bills of the lines are updated,
+// new lines are saved and the bills of removed lines are deleted. The bills are the ones of the message by line.
+func (a *app) updateTextBills(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, bills map[int]int64) {
+	lines := entryLines(message.Text)
+	sentAt := time.Unix(int64(message.Date), 0)
+	var updated []*PreparedBill
+	var added []*PreparedBill
+	for i, line := range lines {
+		billId, ok := bills[i+1]
+		if !ok {
+			bill := a.prepareTextBill(ctx, line, sentAt)
+			updated = append(updated, bill)
+			added = append(added, bill)
+			continue
+		}
+		bill := &PreparedBill{Line: line, Id: billId}
+		bill.Bill, bill.ErrMsg, bill.Err = a.updateTextBill(ctx, billId, line, sentAt)
+		updated = append(updated, bill)
+	}
+	for line, billId := range bills {
+		if line <= len(lines) {
+			continue
+		}
+		if err := a.Repository.DeleteBill(ctx, billId); err != nil {
+			log.Ctx(ctx).Error().Err(err).Int64("bill", billId).Msg(ErrorDeletingBill)
+			continue
+		}
+		log.Ctx(ctx).Info().Int64("bill", billId).Msg("bill of a removed line deleted")
+	}
+	if !a.saveTextBills(ctx, bot, message, added) {
+		return
+	}
+	a.replyTextBills(ctx, bot, message, updated)
+}
+
+// prepareTextBill parses the line of a multi-line message, the bill has Err and ErrMsg set if it fails.
+func (a *app) prepareTextBill(ctx context.Context, line string, sentAt time.Time) *PreparedBill {
+	bill := &PreparedBill{Line: line}
+	bill.Bill, bill.Currency, bill.ErrMsg, bill.Err = a.parseTextBill(ctx, line, sentAt, sentAt)
+	if bill.Err != nil {
+		return bill
+	}
+	bill.Usd, bill.Err = a.curCash.Get(ctx, bill.Bill.BoughtAt, "USD")
+	if bill.Err != nil {
+		bill.ErrMsg = ErrorGettingCurrency
+	}
+	return bill
+}
+
+// saveTextBills saves the bills that are parsed, it replies with an error and returns false if the transaction fails.
+func (a *app) saveTextBills(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, bills []*PreparedBill) bool {
+	var prepared []*PreparedBill
+	for _, bill := range bills {
+		if bill.Err == nil {
+			prepared = append(prepared, bill)
+		}
+	}
+	if len(prepared) == 0 {
+		return true
+	}
+	billIds, err := a.Repository.SaveBills(ctx, message.From, message.Chat, prepared)
+	if err != nil {
+		a.sendErrMessage(ctx, err, ErrorSavingBill, bot, message)
+		return false
+	}
+	for i, bill := range prepared {
+		bill.Id = billIds[i]
+	}
+	return true
+}
+
+// replyTextBills replies with a summary per line and links the bills to the message and the reply by their line.
+// A bill of an unknown category gets the category picker.
+func (a *app) replyTextBills(ctx context.Context, bot *tgbotapi.BotAPI, message *tgbotapi.Message, bills []*PreparedBill) {
+	var sb strings.Builder
+	saved := 0
+	for _, bill := range bills {
+		if bill.Err != nil {
+			if bill.ErrMsg == "" {
+				bill.ErrMsg = ErrorSavingBill
+			}
+			log.Ctx(ctx).Error().Err(bill.Err).Str("line", bill.Line).Msg(bill.ErrMsg)
+			a.storeMessage(bill.Line)
+			sb.WriteString(fmt.Sprintf(LineFailed, bill.Line, bill.ErrMsg) + "\n")
+			continue
+		}
+		saved++
+		sb.WriteString(fmt.Sprintf(LineSaved, bill.Line, bill.Bill.Category) + "\n")
+	}
+	sb.WriteString(fmt.Sprintf(LinesSaved, saved, len(bills)))
+	log.Ctx(ctx).Info().Msgf("string bills saved: %d of %d", saved, len(bills))
+	replyId := a.sendMessage(bot, message.Chat.ID, message.MessageID, sb.String())
+
+	for i, bill := range bills {
+		if bill.Err != nil {
+			continue
+		}
+		a.saveBillMessages(ctx, bill.Id, i+1, message, replyId)
+		if bill.Bill.Category == UnknownCategory {
+			a.sendCategoryPicker(ctx, bot, message, bill.Id, i+1, bill.Bill.Description)
+		}
+	}
+}
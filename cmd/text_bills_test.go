@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditedLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		bills  map[int]int64
+		text   string
+		lines  map[int]int64
+		byLine bool
+	}{
+		{"single", map[int]int64{0: 7}, "500 кафе", map[int]int64{0: 7}, false},
+		{"single into lines", map[int]int64{0: 7}, "500 кафе\n200 такси", map[int]int64{1: 7}, true},
+		{"single with blank lines", map[int]int64{0: 7}, "\n500 кафе\n\n", map[int]int64{0: 7}, false},
+		{"lines", map[int]int64{1: 7, 2: 8}, "500 кафе\n200 такси", map[int]int64{1: 7, 2: 8}, true},
+		{"lines into one", map[int]int64{1: 7, 2: 8}, "500 кафе", map[int]int64{1: 7, 2: 8}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, byLine := editedLines(tt.bills, tt.text)
+			if byLine != tt.byLine || !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("editedLines(%v, %q) = %v %t, want %v %t", tt.bills, tt.text, lines, byLine, tt.lines, tt.byLine)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/xml"
 	"math/big"
+	"sync"
 	"time"
 )
 
@@ -11,14 +13,105 @@ type Bill struct {
 	BoughtAt    time.Time
 	Description string
 	Category    string
+	Note        string
+	Expression  string
+	Tags        []string
 	Items       []Item
+
+	// InvoiceNumber and InvoiceCounter identify a fiscal receipt, they are empty for manual entries
+	InvoiceNumber  string
+	InvoiceCounter string
+	Merchant       *Merchant
+	Cashier        string
+	PaymentMethod  string
+}
+
+// Merchant is the point of sale from the header of a fiscal receipt.
+type Merchant struct {
+	Pib          string
+	Company      string
+	Name         string
+	Address      string
+	Municipality string
+}
+
+// MerchantRule sets the category of the receipts from the company with the PIB
+// or from the shops with the pattern in the name, only one of them is set.
+type MerchantRule struct {
+	Pib         string
+	NamePattern string
+	Category    string
+}
+
+func (r MerchantRule) Key() string {
+	if r.Pib != "" {
+		return r.Pib
+	}
+	return r.NamePattern
+}
+
+// Title is the shop name or the company name if the receipt has no shop.
+func (m *Merchant) Title() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return m.Company
+}
+
+// SavedBill is a short description of a bill already in the database.
+type SavedBill struct {
+	Id       int64
+	BoughtAt time.Time
+	Amount   int64
+	Currency string
+}
+
+type CategoryMapping struct {
+	Description string
+	Category    string
+}
+
+type ReportFilter struct {
+	ChatId     int64
+	TelegramId int64
+	Tags       []string
+}
+
+type CategoryTotal struct {
+	Category  string
+	AmountRub int64
+	AmountUsd int64
+}
+
+type PayerTotal struct {
+	Name      string
+	AmountRub int64
+	AmountUsd int64
+}
+
+// PreparedBill is a parsed bill waiting to be saved together with others; Id or Err is set after saving.
+type PreparedBill struct {
+	Line     string
+	Bill     *Bill
+	Currency *Currency
+	Usd      *Currency
+	Id       int64
+	Err      error
+	ErrMsg   string
 }
 
 type Item struct {
-	Name  string
-	Price int64
-	Count float64
-	Sum   int64
+	Name     string
+	Price    int64
+	Count    float64
+	Sum      int64
+	Category string
+}
+
+// ItemRule sets the category of the receipt items with names matching the pattern, a keyword or a regular expression.
+type ItemRule struct {
+	Pattern  string
+	Category string
 }
 
 type ValCurs struct {
@@ -36,15 +129,11 @@ type Valute struct {
 }
 
 type Response struct {
-	Meta Meta `json:"meta"`
-	Data Data `json:"data"`
+	Meta Meta                     `json:"meta"`
+	Data map[string]CurrencyValue `json:"data"`
 }
 
-type Data struct {
-	Rub Rub `json:"RUB"`
-}
-
-type Rub struct {
+type CurrencyValue struct {
 	Code  string  `json:"code"`
 	Value float64 `json:"value"`
 }
@@ -60,6 +149,25 @@ type Currency struct {
 	Symbol  string
 }
 
+type CurrencyInfo struct {
+	NumCode int64
+	Code    string
+	Title   string
+	Aliases []string
+}
+
 type CurCash struct {
-	m map[string](map[string]Currency)
+	mu         sync.Mutex
+	m          map[string](map[string]Currency)
+	calls      map[string]*rateCall
+	currencies []CurrencyInfo
+	aliases    CurrencyAliases
+	load       func(ctx context.Context, date time.Time, code string, currencies []CurrencyInfo) (map[string]Currency, error)
+}
+
+// rateCall is a load of rates for a date in progress, done is closed when it finishes.
+type rateCall struct {
+	done     chan struct{}
+	valueMap map[string]Currency
+	err      error
 }
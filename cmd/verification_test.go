@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testVerificationLink builds the vl payload of the testdata receipt, the encrypted data and signature are zeros.
+func testVerificationLink(totalAmount uint64) string {
+	data := make([]byte, 41, 44+512+md5.Size)
+	data[0] = 3
+	copy(data[1:17], "8T5MU42C8T5MU42C")
+	binary.LittleEndian.PutUint32(data[17:21], 7446)
+	binary.LittleEndian.PutUint32(data[21:25], 7417)
+	binary.LittleEndian.PutUint64(data[25:33], totalAmount)
+	issuedAt := time.Date(2023, 2, 7, 18, 19, 53, 120*int(time.Millisecond), time.UTC)
+	binary.LittleEndian.PutUint64(data[33:41], uint64(issuedAt.UnixMilli()))
+	data = append(data, 0, 0, 0)
+	data = append(data, make([]byte, 512)...)
+	sum := md5.Sum(data)
+	data = append(data, sum[:]...)
+	return SufPursGovRs + "v/?vl=" + url.QueryEscape(base64.StdEncoding.EncodeToString(data))
+}
+
+func TestParseVerificationLink(t *testing.T) {
+	v, err := parseVerificationLink(testVerificationLink(3899700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bill := v.Bill()
+	if bill.TotalAmount != 38997 {
+		t.Errorf("total = %d, want 38997", bill.TotalAmount)
+	}
+	if want := time.Date(2023, 2, 7, 19, 19, 53, 0, time.UTC); !bill.BoughtAt.Equal(want) {
+		t.Errorf("bought at %s, want %s", bill.BoughtAt, want)
+	}
+	if bill.InvoiceNumber != "8T5MU42C-8T5MU42C-7446" || bill.InvoiceCounter != "7417/7446ПП" {
+		t.Errorf("invoice = %q %q, want %q %q", bill.InvoiceNumber, bill.InvoiceCounter, "8T5MU42C-8T5MU42C-7446", "7417/7446ПП")
+	}
+
+	link := testVerificationLink(3899700)
+	if _, err := parseVerificationLink(link[:len(link)-8]); err == nil {
+		t.Error("cut off link is decoded")
+	}
+	if _, err := parseVerificationLink(SufPursGovRs + "v/?vl=abc"); err == nil {
+		t.Error("invalid vl is decoded")
+	}
+}
+
+func TestCrossCheck(t *testing.T) {
+	scraped, err := parseBil(readReceipt(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := parseVerificationLink(testVerificationLink(3899700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches := v.crossCheck(scraped); len(mismatches) != 0 {
+		t.Errorf("mismatches = %v, want none", mismatches)
+	}
+
+	v, err = parseVerificationLink(testVerificationLink(4899700))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches := v.crossCheck(scraped); len(mismatches) != 1 || scraped.TotalAmount != 48997 {
+		t.Errorf("mismatches = %v, total = %d, want the total of the link", mismatches, scraped.TotalAmount)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	WebhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	DefaultWebhookAddr  = ":8080"
+
+	webhookBufferSize = 100
+	maxWebhookBody    = 1 << 20
+	shutdownTimeout   = 10 * time.Second
+)
+
+// receiveUpdates uses a webhook when HOMEBUDGET_WEBHOOK_URL is set and long polling otherwise.
+// In webhook mode the server listens on HOMEBUDGET_WEBHOOK_ADDR and accepts only requests
+// with HOMEBUDGET_WEBHOOK_SECRET in the secret token header, a random secret is used if it is not set.
+// The returned func stops receiving and closes the channel once the updates already confirmed to telegram are in it,
+// so the channel has to be read while it runs.
+func receiveUpdates(bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, func(), error) {
+	webhookUrl := os.Getenv("HOMEBUDGET_WEBHOOK_URL")
+	if webhookUrl == "" {
+		_, err := bot.Request(tgbotapi.DeleteWebhookConfig{})
+		if err != nil {
+			return nil, nil, err
+		}
+		updates, stop := pollUpdates(bot)
+		return updates, stop, nil
+	}
+
+	link, err := url.Parse(webhookUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret := os.Getenv("HOMEBUDGET_WEBHOOK_SECRET")
+	if secret == "" {
+		secret, err = newWebhookSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Warn().Msg("HOMEBUDGET_WEBHOOK_SECRET is not set, a random secret is used")
+	}
+	addr := os.Getenv("HOMEBUDGET_WEBHOOK_ADDR")
+	if addr == "" {
+		addr = DefaultWebhookAddr
+	}
+
+	err = setWebhook(bot, webhookUrl, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := make(chan tgbotapi.Update, webhookBufferSize)
+	path := link.Path
+	if path == "" {
+		path = "/"
+	}
+	handler := &webhookHandler{secret: secret, updates: updates}
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		log.Info().Msgf("listening for webhook on %s%s", addr, path)
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("webhook server stopped")
+			handler.close()
+		}
+	}()
+
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("error stopping webhook server")
+		}
+		handler.close()
+	}
+	return updates, stop, nil
+}
+
+// pollUpdates receives updates with long polling. The updates in the buffer of tgbotapi are confirmed
+// by the poll in progress, so on stop they are passed on, the ones of that poll will come again after restart.
+func pollUpdates(bot *tgbotapi.BotAPI) (tgbotapi.UpdatesChannel, func()) {
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = 60
+	received := bot.GetUpdatesChan(u)
+
+	updates := make(chan tgbotapi.Update)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(updates)
+		for {
+			select {
+			case update, ok := <-received:
+				if !ok {
+					return
+				}
+				updates <- update
+			case <-stopped:
+				for {
+					select {
+					case update, ok := <-received:
+						if !ok {
+							return
+						}
+						updates <- update
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	stop := func() {
+		bot.StopReceivingUpdates()
+		close(stopped)
+	}
+	return updates, stop
+}
+
+// setWebhook is a raw request since tgbotapi.WebhookConfig has no secret token.
+func setWebhook(bot *tgbotapi.BotAPI, webhookUrl string, secret string) error {
+	params := tgbotapi.Params{"url": webhookUrl}
+	params["secret_token"] = secret
+	resp, err := bot.MakeRequest("setWebhook", params)
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("setWebhook failed: %s", resp.Description)
+	}
+	return nil
+}
+
+// newWebhookSecret returns a secret token of the allowed characters A-Z, a-z, 0-9, _ and -.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type webhookHandler struct {
+	secret  string
+	updates chan<- tgbotapi.Update
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// close closes the updates channel after the updates being passed on, the later requests get 503.
+func (h *webhookHandler) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.updates)
+	}
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(WebhookSecretHeader)), []byte(h.secret)) != 1 {
+		log.Warn().Str("remote", r.RemoteAddr).Msg("webhook request with wrong secret token")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBody)).Decode(&update)
+	if err != nil {
+		log.Error().Err(err).Msg("error decoding webhook update")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	select {
+	case h.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	body, err := os.ReadFile("testdata/update.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		secret  string
+		body    []byte
+		status  int
+		updates int
+	}{
+		{"update", http.MethodPost, "s3cret", body, http.StatusOK, 1},
+		{"wrong secret", http.MethodPost, "wrong", body, http.StatusUnauthorized, 0},
+		{"no secret", http.MethodPost, "", body, http.StatusUnauthorized, 0},
+		{"not json", http.MethodPost, "s3cret", []byte("500 кафе"), http.StatusBadRequest, 0},
+		{"too large", http.MethodPost, "s3cret", []byte(`{"update_id":1,"message":{"text":"` + strings.Repeat("1", maxWebhookBody) + `"}}`), http.StatusBadRequest, 0},
+		{"get", http.MethodGet, "s3cret", nil, http.StatusMethodNotAllowed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			server := httptest.NewServer(&webhookHandler{secret: "s3cret", updates: updates})
+			defer server.Close()
+
+			req, err := http.NewRequest(tt.method, server.URL+"/bot", bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.secret != "" {
+				req.Header.Set(WebhookSecretHeader, tt.secret)
+			}
+			res, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if len(updates) != tt.updates {
+				t.Fatalf("got %d updates, want %d", len(updates), tt.updates)
+			}
+			if tt.updates > 0 {
+				update := <-updates
+				if update.UpdateID != 512341 || update.Message == nil || update.Message.Text != "500 кафе" || update.Message.From.UserName != "konst" {
+					t.Errorf("unexpected update: %+v", update)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerClose(t *testing.T) {
+	body, err := os.ReadFile("testdata/update.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan tgbotapi.Update, 1)
+	handler := &webhookHandler{secret: "s3cret", updates: updates}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func() int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/bot", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(WebhookSecretHeader, "s3cret")
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	if status := post(); status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", status, http.StatusOK)
+	}
+	handler.close()
+	if status := post(); status != http.StatusServiceUnavailable {
+		t.Errorf("status after close = %d, want %d", status, http.StatusServiceUnavailable)
+	}
+
+	var received int
+	for range updates {
+		received++
+	}
+	if received != 1 {
+		t.Errorf("got %d updates after close, want 1", received)
+	}
+}
@@ -1,9 +1,13 @@
 CREATE SEQUENCE seq_bill_id START 1001;
 CREATE SEQUENCE seq_bill_item_id START 100001;
 CREATE SEQUENCE seq_user_id START 101;
+CREATE SEQUENCE seq_ledger_id START 1;
+CREATE SEQUENCE seq_merchant_id START 1;
+CREATE SEQUENCE seq_merchant_category_id START 1;
 
 CREATE TABLE users (
   id BIGINT NOT NULL DEFAULT nextval('seq_user_id') PRIMARY KEY,
+  telegram_id bigint,
   user_name varchar(255) not null default '',
   first_name varchar(255),
   last_name varchar(255),
@@ -11,16 +15,35 @@ CREATE TABLE users (
   created_at timestamptz not null default CURRENT_TIMESTAMP
 );
 
+CREATE TABLE ledgers (
+  id BIGINT NOT NULL DEFAULT nextval('seq_ledger_id') PRIMARY KEY,
+  chat_id bigint not null,
+  title varchar(255) not null default '',
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+CREATE TABLE merchants (
+  id BIGINT NOT NULL DEFAULT nextval('seq_merchant_id') PRIMARY KEY,
+  pib varchar(20) not null,
+  name varchar(255) not null default '',
+  company varchar(255) not null default '',
+  address varchar(255) not null default '',
+  municipality varchar(255) not null default '',
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
 CREATE TABLE currencies (
   id BIGINT NOT NULL PRIMARY KEY,
   code varchar(10) not null default '',
   title varchar(255) not null default '',
-  format varchar(255) not null default '%s'
+  format varchar(255) not null default '%s',
+  aliases varchar(255)[] not null default '{}'
 );
 
 CREATE TABLE bills (
   id BIGINT NOT NULL DEFAULT nextval('seq_bill_id') PRIMARY KEY,
   user_id bigint not null,
+  ledger_id bigint,
   bought_at timestamp not null,
   description varchar(255),
   category varchar(255),
@@ -28,8 +51,17 @@ CREATE TABLE bills (
   currency bigint not null,
   amount_rub bigint not null default 0,
   amount_usd bigint not null default 0,
+  note text,
+  amount_expression varchar(255),
+  invoice_number varchar(64),
+  invoice_counter varchar(64),
+  merchant_id bigint,
+  cashier varchar(255),
+  payment_method varchar(255),
   created_at timestamptz not null default CURRENT_TIMESTAMP,
   CONSTRAINT fk_user_id FOREIGN KEY(user_id) REFERENCES users(id),
+  CONSTRAINT fk_ledger_id FOREIGN KEY(ledger_id) REFERENCES ledgers(id),
+  CONSTRAINT fk_merchant_id FOREIGN KEY(merchant_id) REFERENCES merchants(id),
   CONSTRAINT fk_currency FOREIGN KEY(currency) REFERENCES currencies(id)
 );
 
@@ -43,6 +75,7 @@ CREATE TABLE bill_items (
   currency bigint not null,
   amount_rub bigint not null default 0,
   amount_usd bigint not null default 0,
+  category varchar(255),
   created_at timestamptz not null default CURRENT_TIMESTAMP,
   CONSTRAINT fk_bill_id FOREIGN KEY(bill_id) REFERENCES bills(id),
   CONSTRAINT fk_currency FOREIGN KEY(currency) REFERENCES currencies(id)
@@ -53,28 +86,118 @@ CREATE TABLE desc_categories (
   category varchar(255) not null
 );
 
+CREATE TABLE merchant_categories (
+  id BIGINT NOT NULL DEFAULT nextval('seq_merchant_category_id') PRIMARY KEY,
+  pib varchar(20),
+  name_pattern varchar(255),
+  category varchar(255) not null,
+  created_at timestamptz not null default CURRENT_TIMESTAMP,
+  CONSTRAINT chk_pib_or_name CHECK ((pib IS NULL) <> (name_pattern IS NULL))
+);
+
+CREATE TABLE item_categories (
+  pattern varchar(255) not null PRIMARY KEY,
+  category varchar(255) not null,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+CREATE TABLE bill_tags (
+  bill_id bigint not null,
+  tag varchar(255) not null,
+  PRIMARY KEY (bill_id, tag),
+  CONSTRAINT fk_bill_id FOREIGN KEY(bill_id) REFERENCES bills(id)
+);
+
+CREATE TABLE bill_messages (
+  chat_id bigint not null,
+  message_id bigint not null,
+  bill_id bigint not null,
+  line_no int not null default 0,
+  created_at timestamptz not null default CURRENT_TIMESTAMP,
+  PRIMARY KEY (chat_id, message_id, line_no),
+  CONSTRAINT fk_bill_id FOREIGN KEY(bill_id) REFERENCES bills(id)
+);
+
+CREATE TABLE members (
+  telegram_id bigint not null PRIMARY KEY,
+  is_admin boolean not null default false,
+  invited_by bigint,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+CREATE TABLE invites (
+  code varchar(64) not null PRIMARY KEY,
+  created_by bigint not null,
+  used_by bigint,
+  used_at timestamptz,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
 CREATE INDEX idx_users_name ON users (user_name);
+CREATE UNIQUE INDEX idx_users_telegram_id ON users (telegram_id);
+CREATE UNIQUE INDEX idx_ledgers_chat ON ledgers (chat_id);
+CREATE INDEX idx_bills_ledger_date ON bills (ledger_id, bought_at);
+CREATE UNIQUE INDEX idx_bills_ledger_invoice ON bills (ledger_id, invoice_number);
+CREATE UNIQUE INDEX idx_merchants_pib_name ON merchants (pib, name);
+CREATE INDEX idx_bills_merchant ON bills (merchant_id);
+CREATE UNIQUE INDEX idx_merchant_categories_pib ON merchant_categories (pib);
+CREATE UNIQUE INDEX idx_merchant_categories_name ON merchant_categories (name_pattern);
+CREATE INDEX idx_bill_items_bill ON bill_items (bill_id);
 CREATE INDEX idx_bills_date_category ON bills (bought_at, category);
 CREATE INDEX idx_bills_category ON bills (category);
 CREATE INDEX idx_bill_items_title ON bill_items (title);
+CREATE INDEX idx_bill_messages_bill ON bill_messages (bill_id);
+CREATE INDEX idx_bill_tags_tag ON bill_tags (tag);
+
+CREATE VIEW bill_amounts AS
+SELECT b.id AS bill_id, COALESCE(i.category, b.category, '-') AS category, i.amount_rub, i.amount_usd
+FROM bills b
+JOIN bill_items i ON i.bill_id = b.id
+WHERE EXISTS (SELECT 1 FROM bill_items c WHERE c.bill_id = b.id AND c.category IS NOT NULL)
+UNION ALL
+SELECT b.id, COALESCE(b.category, '-'), b.amount_rub, b.amount_usd
+FROM bills b
+WHERE NOT EXISTS (SELECT 1 FROM bill_items c WHERE c.bill_id = b.id AND c.category IS NOT NULL);
 
 COMMENT ON TABLE currencies IS 'валюты';
 COMMENT ON COLUMN currencies.code IS 'код валюты';
 COMMENT ON COLUMN currencies.title IS 'наименование валюты';
 COMMENT ON COLUMN currencies.format IS 'формат вывода';
+COMMENT ON COLUMN currencies.aliases IS 'символы и названия валюты в сообщениях, кроме кода';
 
 COMMENT ON TABLE users IS 'пользователи';
+COMMENT ON COLUMN users.telegram_id IS 'id пользователя в telegram';
 COMMENT ON COLUMN users.user_name IS 'ник пользователя';
 COMMENT ON COLUMN users.first_name IS 'имя';
 COMMENT ON COLUMN users.last_name IS 'фамилия';
 COMMENT ON COLUMN users.lang IS 'язык';
 
+COMMENT ON TABLE ledgers IS 'бюджеты: общий для группового чата, личный для чата с ботом';
+COMMENT ON COLUMN ledgers.chat_id IS 'чат telegram';
+COMMENT ON COLUMN ledgers.title IS 'название чата или имя пользователя';
+
+COMMENT ON TABLE merchants IS 'точки продаж из фискальных чеков';
+COMMENT ON COLUMN merchants.pib IS 'ПИБ, налоговый номер предприятия';
+COMMENT ON COLUMN merchants.name IS 'место продаје, название магазина';
+COMMENT ON COLUMN merchants.company IS 'предузеће, название предприятия';
+COMMENT ON COLUMN merchants.address IS 'адрес';
+COMMENT ON COLUMN merchants.municipality IS 'община';
+
 COMMENT ON TABLE bills IS 'счета';
+COMMENT ON COLUMN bills.user_id IS 'кто платил';
+COMMENT ON COLUMN bills.ledger_id IS 'бюджет';
 COMMENT ON COLUMN bills.amount IS 'сумма счета';
 COMMENT ON COLUMN bills.currency IS 'валюта счета';
 COMMENT ON COLUMN bills.amount_rub IS 'сумма счета в рублях';
 COMMENT ON COLUMN bills.amount_usd IS 'сумма счета в долларах';
 COMMENT ON COLUMN bills.bought_at IS 'дата покупки';
+COMMENT ON COLUMN bills.note IS 'заметка';
+COMMENT ON COLUMN bills.amount_expression IS 'выражение, из которого посчитана сумма, например 120+80+45';
+COMMENT ON COLUMN bills.invoice_number IS 'ПФР број рачуна фискального чека';
+COMMENT ON COLUMN bills.invoice_counter IS 'бројач рачуна фискального чека';
+COMMENT ON COLUMN bills.merchant_id IS 'магазин фискального чека';
+COMMENT ON COLUMN bills.cashier IS 'кассир';
+COMMENT ON COLUMN bills.payment_method IS 'способ оплаты: Готовина, Платна картица и другие';
 
 COMMENT ON TABLE bill_items IS 'товары в счете';
 COMMENT ON COLUMN bill_items.title IS 'наимнование товара';
@@ -84,56 +207,89 @@ COMMENT ON COLUMN bill_items.amount IS 'сумма';
 COMMENT ON COLUMN bill_items.currency IS 'валюта';
 COMMENT ON COLUMN bill_items.amount_rub IS 'сумма в рублях';
 COMMENT ON COLUMN bill_items.amount_usd IS 'сумма в долларах';
+COMMENT ON COLUMN bill_items.category IS 'категория товара, если отличается от категории счета';
 
 COMMENT ON TABLE desc_categories IS 'описание категорий';
 COMMENT ON COLUMN desc_categories.description IS 'описание';
 COMMENT ON COLUMN desc_categories.category IS 'категория';
 
-insert into currencies(id, code, title, format)
-values (36, 'AUD', 'Австралийский доллар', '%s'),
-       (51, 'AMD', 'Армянских драмов', '%s ֏'),
-       (124, 'CAD', 'Канадский доллар', '%s'),
-       (156, 'CNY', 'Китайский юань', '%s'),
-       (203, 'CZK', 'Чешских крон', '%s'),
-       (208, 'DKK', 'Датская крона', '%s'),
-       (344, 'HKD', 'Гонконгских долларов', '%s'),
-       (348, 'HUF', 'Венгерских форинтов', '%s'),
-       (356, 'INR', 'Индийских рупий', '%s'),
-       (360, 'IDR', 'Индонезийских рупий', '%s'),
-       (392, 'JPY', 'Японских иен', '%s'),
-       (398, 'KZT', 'Казахстанских тенге', '%s'),
-       (410, 'KRW', 'Вон Республики Корея', '%s'),
-       (417, 'KGS', 'Киргизских сомов', '%s'),
-       (498, 'MDL', 'Молдавских леев', '%s'),
-       (554, 'NZD', 'Новозеландский доллар', '%s'),
-       (578, 'NOK', 'Норвежских крон', '%s'),
-       (634, 'QAR', 'Катарский риал', '%s'),
-       (643, 'RUB', 'Российский рубль', '%s ₽'),
-       (702, 'SGD', 'Сингапурский доллар', '%s'),
-       (704, 'VND', 'Вьетнамских донгов', '%s'),
-       (710, 'ZAR', 'Южноафриканских рэндов', '%s'),
-       (752, 'SEK', 'Шведских крон', '%s'),
-       (756, 'CHF', 'Швейцарский франк', '%s'),
-       (764, 'THB', 'Таиландских батов', '%s'),
-       (784, 'AED', 'Дирхам ОАЭ', '%s'),
-       (818, 'EGP', 'Египетских фунтов', '%s'),
-       (826, 'GBP', 'Фунт стерлингов Соединенного королевства', '%s £'),
-       (840, 'USD', 'Доллар США', '$%s'),
-       (860, 'UZS', 'Узбекских сумов', '%s'),
-       (933, 'BYN', 'Белорусский рубль', '%s'),
-       (934, 'TMT', 'Новый туркменский манат', '%s'),
-       (941, 'RSD', 'Сербских динаров', '%s'),
-       (944, 'AZN', 'Азербайджанский манат', '%s'),
-       (946, 'RON', 'Румынский лей', '%s'),
-       (949, 'TRY', 'Турецких лир', '%s ₺'),
-       (960, 'XDR', 'СДР (специальные права заимствования)', '%s'),
-       (972, 'TJS', 'Таджикских сомони', '%s'),
-       (975, 'BGN', 'Болгарский лев', '%s'),
-       (978, 'EUR', 'Евро', '%s €'),
-       (980, 'UAH', 'Украинских гривен', '%s'),
-       (981, 'GEL', 'Грузинский лари', '%s'),
-       (985, 'PLN', 'Польский злотый', '%s'),
-       (986, 'BRL', 'Бразильский реал', '%s')
+COMMENT ON TABLE merchant_categories IS 'категории чеков по магазинам';
+COMMENT ON COLUMN merchant_categories.pib IS 'ПИБ предприятия, проверяется первым';
+COMMENT ON COLUMN merchant_categories.name_pattern IS 'часть названия магазина или предприятия в нижнем регистре';
+COMMENT ON COLUMN merchant_categories.category IS 'категория';
+
+COMMENT ON TABLE item_categories IS 'категории товаров в чеках';
+COMMENT ON COLUMN item_categories.pattern IS 'слово или регулярное выражение для названия товара, без учета регистра';
+COMMENT ON COLUMN item_categories.category IS 'категория';
+
+COMMENT ON VIEW bill_amounts IS 'суммы счетов по категориям: по товарам, если у товаров есть категории, иначе весь счет';
+
+COMMENT ON TABLE bill_tags IS 'теги счетов';
+COMMENT ON COLUMN bill_tags.bill_id IS 'счет';
+COMMENT ON COLUMN bill_tags.tag IS 'тег без #';
+
+COMMENT ON TABLE bill_messages IS 'сообщения telegram, связанные со счетом';
+COMMENT ON COLUMN bill_messages.chat_id IS 'чат';
+COMMENT ON COLUMN bill_messages.message_id IS 'сообщение пользователя или ответ бота';
+COMMENT ON COLUMN bill_messages.bill_id IS 'счет';
+COMMENT ON COLUMN bill_messages.line_no IS 'номер строки в сообщении с несколькими тратами, 0 для одной траты';
+
+COMMENT ON TABLE members IS 'пользователи telegram, которым разрешено пользоваться ботом';
+COMMENT ON COLUMN members.telegram_id IS 'id пользователя в telegram';
+COMMENT ON COLUMN members.is_admin IS 'может приглашать и удалять участников';
+COMMENT ON COLUMN members.invited_by IS 'telegram id пригласившего';
+
+COMMENT ON TABLE invites IS 'одноразовые приглашения';
+COMMENT ON COLUMN invites.code IS 'код приглашения';
+COMMENT ON COLUMN invites.created_by IS 'telegram id пригласившего';
+COMMENT ON COLUMN invites.used_by IS 'telegram id принявшего приглашение';
+COMMENT ON COLUMN invites.used_at IS 'когда приглашение принято';
+
+insert into currencies(id, code, title, format, aliases)
+values (36, 'AUD', 'Австралийский доллар', '%s', '{"a$"}'),
+       (51, 'AMD', 'Армянских драмов', '%s ֏', '{"֏","dram","драм","драмов"}'),
+       (124, 'CAD', 'Канадский доллар', '%s', '{"c$"}'),
+       (156, 'CNY', 'Китайский юань', '%s', '{"¥","юань","юаней","rmb"}'),
+       (203, 'CZK', 'Чешских крон', '%s', '{"kč","крон","крона"}'),
+       (208, 'DKK', 'Датская крона', '%s', '{"дкр"}'),
+       (344, 'HKD', 'Гонконгских долларов', '%s', '{"hk$"}'),
+       (348, 'HUF', 'Венгерских форинтов', '%s', '{"ft","форинт","форинтов"}'),
+       (356, 'INR', 'Индийских рупий', '%s', '{"₹","рупий","рупия"}'),
+       (360, 'IDR', 'Индонезийских рупий', '%s', '{"rp"}'),
+       (392, 'JPY', 'Японских иен', '%s', '{"иен","иена","йен"}'),
+       (398, 'KZT', 'Казахстанских тенге', '%s', '{"₸","тенге"}'),
+       (410, 'KRW', 'Вон Республики Корея', '%s', '{"₩"}'),
+       (417, 'KGS', 'Киргизских сомов', '%s', '{"сомов"}'),
+       (498, 'MDL', 'Молдавских леев', '%s', '{"лей","леев"}'),
+       (554, 'NZD', 'Новозеландский доллар', '%s', '{"nz$"}'),
+       (578, 'NOK', 'Норвежских крон', '%s', '{"нкр"}'),
+       (634, 'QAR', 'Катарский риал', '%s', '{"риал","риалов"}'),
+       (643, 'RUB', 'Российский рубль', '%s ₽', '{"₽","р","руб","рублей","рубль","rub"}'),
+       (702, 'SGD', 'Сингапурский доллар', '%s', '{"s$"}'),
+       (704, 'VND', 'Вьетнамских донгов', '%s', '{"₫","донг","донгов"}'),
+       (710, 'ZAR', 'Южноафриканских рэндов', '%s', '{"рэнд","рэндов"}'),
+       (752, 'SEK', 'Шведских крон', '%s', '{"шкр"}'),
+       (756, 'CHF', 'Швейцарский франк', '%s', '{"франков"}'),
+       (764, 'THB', 'Таиландских батов', '%s', '{"฿","батов"}'),
+       (784, 'AED', 'Дирхам ОАЭ', '%s', '{"дирхам","дирхамов"}'),
+       (818, 'EGP', 'Египетских фунтов', '%s', '{"е£"}'),
+       (826, 'GBP', 'Фунт стерлингов Соединенного королевства', '%s £', '{"£","фунт","фунтов"}'),
+       (840, 'USD', 'Доллар США', '$%s', '{"$","дол","долл","долларов","доллар","бакс","баксов"}'),
+       (860, 'UZS', 'Узбекских сумов', '%s', '{"сумов"}'),
+       (933, 'BYN', 'Белорусский рубль', '%s', '{"бр"}'),
+       (934, 'TMT', 'Новый туркменский манат', '%s', '{"манат"}'),
+       (941, 'RSD', 'Сербских динаров', '%s', '{"дин","динар","динаров","din","рсд"}'),
+       (944, 'AZN', 'Азербайджанский манат', '%s', '{"₼"}'),
+       (946, 'RON', 'Румынский лей', '%s', '{"lei"}'),
+       (949, 'TRY', 'Турецких лир', '%s ₺', '{"₺","tl","лир","лира","лиры"}'),
+       (960, 'XDR', 'СДР (специальные права заимствования)', '%s', '{"сдр"}'),
+       (972, 'TJS', 'Таджикских сомони', '%s', '{"сомони"}'),
+       (975, 'BGN', 'Болгарский лев', '%s', '{"лв","левов"}'),
+       (978, 'EUR', 'Евро', '%s €', '{"€","евро"}'),
+       (980, 'UAH', 'Украинских гривен', '%s', '{"₴","грн","гривен","гривна"}'),
+       (981, 'GEL', 'Грузинский лари', '%s', '{"₾","лари"}'),
+       (985, 'PLN', 'Польский злотый', '%s', '{"zł","zl","злотый","злотых"}'),
+       (986, 'BRL', 'Бразильский реал', '%s', '{"r$","реалов"}')
 ;
 
 insert into desc_categories(description, category)
@@ -243,3 +399,9 @@ values ('автобус', 'Транспорт'),
        ('осаго', 'Страхование'),
        ('страхование', 'Страхование')
 ;
+
+insert into item_categories(pattern, category)
+values ('пиво|pivo|вино|vino|ракија|rakija|вотка|votka|виски|viski', 'Алкоголь'),
+       ('детерџент|deterdžent|омекшивач|omekšivač|прашак|prašak|тоалет папир|toalet papir', 'Дом и ремонт'),
+       ('шампон|šampon|паста за зубе|pasta za zube|сапун|sapun', 'Красота')
+;
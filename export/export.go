@@ -0,0 +1,229 @@
+package export
+
+import (
+	"bytes"
+	"github.com/xuri/excelize/v2"
+	"sort"
+	"time"
+)
+
+const (
+	SheetRub   = "RUB"
+	SheetUsd   = "USD"
+	SheetBills = "Счета"
+	SheetItems = "Товары"
+	TotalTitle = "Итого"
+
+	defaultSheet = "Sheet1"
+)
+
+type Bill struct {
+	Id          int64
+	BoughtAt    time.Time
+	Category    string
+	Description string
+	PaidBy      string
+	AmountRub   int64
+	AmountUsd   int64
+}
+
+// Item is a line of a receipt that has item categories, such a bill is counted by its items.
+type Item struct {
+	BillId      int64
+	BoughtAt    time.Time
+	Description string
+	Name        string
+	Category    string
+	AmountRub   int64
+	AmountUsd   int64
+}
+
+var (
+	billsHeader = []string{"Дата", "Категория", "Описание", "Кто платил", "RUB", "USD"}
+	itemsHeader = []string{"Дата", "Описание", "Товар", "Категория", "RUB", "USD"}
+)
+
+type data struct {
+	months     []time.Time
+	categories []string
+	rub        map[time.Time]map[string]int64
+	usd        map[time.Time]map[string]int64
+}
+
+// Workbook builds an xlsx file with RUB and USD sheets: a row per category and a column per month,
+// a sheet with every bill and who paid it and a sheet with the items of the bills counted by items.
+func Workbook(bills []Bill, items []Item) ([]byte, error) {
+	d := group(bills, items)
+
+	f := excelize.NewFile()
+	defer func() { _ = f.Close() }()
+
+	idxRub, err := saveToExcel(f, SheetRub, d.rub, d.months, d.categories)
+	if err != nil {
+		return nil, err
+	}
+	_, err = saveToExcel(f, SheetUsd, d.usd, d.months, d.categories)
+	if err != nil {
+		return nil, err
+	}
+	err = saveBills(f, bills)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > 0 {
+		err = saveItems(f, items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.SetActiveSheet(idxRub)
+	err = f.DeleteSheet(defaultSheet)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = f.Write(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// group sums the bills by month and category, the bills with items are summed by the item categories.
+func group(bills []Bill, items []Item) data {
+	d := data{
+		rub: make(map[time.Time]map[string]int64),
+		usd: make(map[time.Time]map[string]int64),
+	}
+	allCategories := map[string]bool{}
+	add := func(boughtAt time.Time, category string, amountRub int64, amountUsd int64) {
+		month := time.Date(boughtAt.Year(), boughtAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if _, ok := d.rub[month]; !ok {
+			d.months = append(d.months, month)
+			d.rub[month] = make(map[string]int64)
+			d.usd[month] = make(map[string]int64)
+		}
+		d.rub[month][category] += amountRub
+		d.usd[month][category] += amountUsd
+
+		if !allCategories[category] {
+			allCategories[category] = true
+			d.categories = append(d.categories, category)
+		}
+	}
+
+	itemized := map[int64]bool{}
+	for _, item := range items {
+		itemized[item.BillId] = true
+		add(item.BoughtAt, item.Category, item.AmountRub, item.AmountUsd)
+	}
+	for _, bill := range bills {
+		if !itemized[bill.Id] {
+			add(bill.BoughtAt, bill.Category, bill.AmountRub, bill.AmountUsd)
+		}
+	}
+	sort.Slice(d.months, func(i, j int) bool { return d.months[i].Before(d.months[j]) })
+	sort.Strings(d.categories)
+	return d
+}
+
+func saveToExcel(f *excelize.File, sheet string, months map[time.Time]map[string]int64, monthNames []time.Time, categories []string) (int, error) {
+	sheetIdx, err := f.NewSheet(sheet)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, category := range categories {
+		err = setCell(f, sheet, 1, i+2, category)
+		if err != nil {
+			return 0, err
+		}
+	}
+	totalRow := len(categories) + 2
+	err = setCell(f, sheet, 1, totalRow, TotalTitle)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, month := range monthNames {
+		col := i + 2
+		err = setCell(f, sheet, col, 1, month.Month().String()[0:3]+" "+month.Format("2006"))
+		if err != nil {
+			return 0, err
+		}
+
+		var sum int64
+		for j, category := range categories {
+			amount := months[month][category]
+			sum += amount
+			err = setCell(f, sheet, col, j+2, toUnits(amount))
+			if err != nil {
+				return 0, err
+			}
+		}
+		err = setCell(f, sheet, col, totalRow, toUnits(sum))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return sheetIdx, nil
+}
+
+func saveBills(f *excelize.File, bills []Bill) error {
+	_, err := f.NewSheet(SheetBills)
+	if err != nil {
+		return err
+	}
+	for i, title := range billsHeader {
+		err = setCell(f, SheetBills, i+1, 1, title)
+		if err != nil {
+			return err
+		}
+	}
+	for i, bill := range bills {
+		row := []interface{}{bill.BoughtAt.Format("02.01.2006"), bill.Category, bill.Description, bill.PaidBy, toUnits(bill.AmountRub), toUnits(bill.AmountUsd)}
+		for j, value := range row {
+			err = setCell(f, SheetBills, j+1, i+2, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func saveItems(f *excelize.File, items []Item) error {
+	_, err := f.NewSheet(SheetItems)
+	if err != nil {
+		return err
+	}
+	for i, title := range itemsHeader {
+		err = setCell(f, SheetItems, i+1, 1, title)
+		if err != nil {
+			return err
+		}
+	}
+	for i, item := range items {
+		row := []interface{}{item.BoughtAt.Format("02.01.2006"), item.Description, item.Name, item.Category, toUnits(item.AmountRub), toUnits(item.AmountUsd)}
+		for j, value := range row {
+			err = setCell(f, SheetItems, j+1, i+2, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func setCell(f *excelize.File, sheet string, col int, row int, value interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(col, row)
+	if err != nil {
+		return err
+	}
+	return f.SetCellValue(sheet, cell, value)
+}
+
+func toUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"bytes"
+	"github.com/xuri/excelize/v2"
+	"testing"
+	"time"
+)
+
+func openWorkbook(t *testing.T, bills []Bill, items []Item) *excelize.File {
+	t.Helper()
+	content, err := Workbook(bills, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func checkCells(t *testing.T, f *excelize.File, sheet string, want map[string]string) {
+	t.Helper()
+	for cell, value := range want {
+		got, err := f.GetCellValue(sheet, cell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != value {
+			t.Errorf("%s!%s = %q, want %q", sheet, cell, got, value)
+		}
+	}
+}
+
+func TestWorkbook(t *testing.T) {
+	jan := time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2023, 2, 5, 0, 0, 0, 0, time.UTC)
+	bills := []Bill{
+		{Id: 1, BoughtAt: jan, Category: "еда", Description: "хлеб", PaidBy: "Аня", AmountRub: 10050, AmountUsd: 110},
+		{Id: 2, BoughtAt: feb, Category: "такси", Description: "аэропорт", PaidBy: "Костя", AmountRub: 200000, AmountUsd: 2200},
+		{Id: 3, BoughtAt: feb, Category: "еда", Description: "Maxi", PaidBy: "Аня", AmountRub: 50000, AmountUsd: 550},
+	}
+	items := []Item{
+		{BillId: 3, BoughtAt: feb, Description: "Maxi", Name: "MLEKO 1L", Category: "молочное", AmountRub: 15000, AmountUsd: 165},
+		{BillId: 3, BoughtAt: feb, Description: "Maxi", Name: "HLEB", Category: "еда", AmountRub: 35000, AmountUsd: 385},
+	}
+	f := openWorkbook(t, bills, items)
+
+	if sheets := f.GetSheetList(); len(sheets) != 4 {
+		t.Errorf("sheets = %v, want %s, %s, %s, %s", sheets, SheetRub, SheetUsd, SheetBills, SheetItems)
+	}
+	// the bill 3 is counted by its items
+	checkCells(t, f, SheetRub, map[string]string{
+		"A2": "еда", "A3": "молочное", "A4": "такси", "A5": TotalTitle,
+		"B1": "Jan 2023", "B2": "100.5", "B3": "0", "B4": "0", "B5": "100.5",
+		"C1": "Feb 2023", "C2": "350", "C3": "150", "C4": "2000", "C5": "2500",
+	})
+	checkCells(t, f, SheetUsd, map[string]string{
+		"B2": "1.1", "B5": "1.1",
+		"C2": "3.85", "C3": "1.65", "C4": "22", "C5": "27.5",
+	})
+	checkCells(t, f, SheetBills, map[string]string{
+		"A1": "Дата", "F1": "USD",
+		"A2": "10.01.2023", "B2": "еда", "C2": "хлеб", "D2": "Аня", "E2": "100.5", "F2": "1.1",
+		"A4": "05.02.2023", "C4": "Maxi", "E4": "500",
+	})
+	checkCells(t, f, SheetItems, map[string]string{
+		"C1": "Товар",
+		"A2": "05.02.2023", "B2": "Maxi", "C2": "MLEKO 1L", "D2": "молочное", "E2": "150", "F2": "1.65",
+		"C3": "HLEB", "D3": "еда",
+	})
+}
+
+func TestWorkbookWithoutItems(t *testing.T) {
+	f := openWorkbook(t, []Bill{{Id: 1, BoughtAt: time.Now(), Category: "еда", AmountRub: 100}}, nil)
+	if idx, _ := f.GetSheetIndex(SheetItems); idx != -1 {
+		t.Errorf("%s sheet without items", SheetItems)
+	}
+}
+
+func TestWorkbookManyMonths(t *testing.T) {
+	// 30 months take the columns B to AE
+	var bills []Bill
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 30; i++ {
+		bills = append(bills, Bill{Id: int64(i + 1), BoughtAt: start.AddDate(0, i, 0), Category: "еда", AmountRub: int64(i+1) * 100})
+	}
+	f := openWorkbook(t, bills, nil)
+	checkCells(t, f, SheetRub, map[string]string{
+		"Z1": "Jan 2023", "Z2": "25",
+		"AA1": "Feb 2023", "AA2": "26",
+		"AE1": "Jun 2023", "AE2": "30", "AE3": "30",
+		"AF1": "",
+	})
+}
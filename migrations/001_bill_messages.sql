@@ -0,0 +1,21 @@
+-- The messages of a bill are kept to delete it with /del and to update it when the message is edited.
+-- Bills saved before have no messages: /del and edits do not find them, /undo still does.
+BEGIN;
+
+CREATE TABLE bill_messages (
+  chat_id bigint not null,
+  message_id bigint not null,
+  bill_id bigint not null,
+  created_at timestamptz not null default CURRENT_TIMESTAMP,
+  PRIMARY KEY (chat_id, message_id),
+  CONSTRAINT fk_bill_id FOREIGN KEY(bill_id) REFERENCES bills(id)
+);
+
+CREATE INDEX idx_bill_messages_bill ON bill_messages (bill_id);
+
+COMMENT ON TABLE bill_messages IS 'сообщения telegram, связанные со счетом';
+COMMENT ON COLUMN bill_messages.chat_id IS 'чат';
+COMMENT ON COLUMN bill_messages.message_id IS 'сообщение пользователя или ответ бота';
+COMMENT ON COLUMN bill_messages.bill_id IS 'счет';
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Manual entries keep the text after the description as a note and the #tags separately.
+BEGIN;
+
+ALTER TABLE bills ADD COLUMN note text;
+
+CREATE TABLE bill_tags (
+  bill_id bigint not null,
+  tag varchar(255) not null,
+  PRIMARY KEY (bill_id, tag),
+  CONSTRAINT fk_bill_id FOREIGN KEY(bill_id) REFERENCES bills(id)
+);
+
+CREATE INDEX idx_bill_tags_tag ON bill_tags (tag);
+
+COMMENT ON COLUMN bills.note IS 'заметка';
+
+COMMENT ON TABLE bill_tags IS 'теги счетов';
+COMMENT ON COLUMN bill_tags.bill_id IS 'счет';
+COMMENT ON COLUMN bill_tags.tag IS 'тег без #';
+
+COMMIT;
@@ -0,0 +1,53 @@
+-- Currencies are recognised by their symbols and names in manual entries, not only by the ISO code.
+BEGIN;
+
+ALTER TABLE currencies ADD COLUMN aliases varchar(255)[] not null default '{}';
+
+UPDATE currencies SET aliases = '{"a$"}' WHERE code = 'AUD';
+UPDATE currencies SET aliases = '{"֏","dram","драм","драмов"}' WHERE code = 'AMD';
+UPDATE currencies SET aliases = '{"c$"}' WHERE code = 'CAD';
+UPDATE currencies SET aliases = '{"¥","юань","юаней","rmb"}' WHERE code = 'CNY';
+UPDATE currencies SET aliases = '{"kč","крон","крона"}' WHERE code = 'CZK';
+UPDATE currencies SET aliases = '{"дкр"}' WHERE code = 'DKK';
+UPDATE currencies SET aliases = '{"hk$"}' WHERE code = 'HKD';
+UPDATE currencies SET aliases = '{"ft","форинт","форинтов"}' WHERE code = 'HUF';
+UPDATE currencies SET aliases = '{"₹","рупий","рупия"}' WHERE code = 'INR';
+UPDATE currencies SET aliases = '{"rp"}' WHERE code = 'IDR';
+UPDATE currencies SET aliases = '{"иен","иена","йен"}' WHERE code = 'JPY';
+UPDATE currencies SET aliases = '{"₸","тенге"}' WHERE code = 'KZT';
+UPDATE currencies SET aliases = '{"₩"}' WHERE code = 'KRW';
+UPDATE currencies SET aliases = '{"сомов"}' WHERE code = 'KGS';
+UPDATE currencies SET aliases = '{"лей","леев"}' WHERE code = 'MDL';
+UPDATE currencies SET aliases = '{"nz$"}' WHERE code = 'NZD';
+UPDATE currencies SET aliases = '{"нкр"}' WHERE code = 'NOK';
+UPDATE currencies SET aliases = '{"риал","риалов"}' WHERE code = 'QAR';
+UPDATE currencies SET aliases = '{"₽","р","руб","рублей","рубль","rub"}' WHERE code = 'RUB';
+UPDATE currencies SET aliases = '{"s$"}' WHERE code = 'SGD';
+UPDATE currencies SET aliases = '{"₫","донг","донгов"}' WHERE code = 'VND';
+UPDATE currencies SET aliases = '{"рэнд","рэндов"}' WHERE code = 'ZAR';
+UPDATE currencies SET aliases = '{"шкр"}' WHERE code = 'SEK';
+UPDATE currencies SET aliases = '{"франков"}' WHERE code = 'CHF';
+UPDATE currencies SET aliases = '{"฿","батов"}' WHERE code = 'THB';
+UPDATE currencies SET aliases = '{"дирхам","дирхамов"}' WHERE code = 'AED';
+UPDATE currencies SET aliases = '{"е£"}' WHERE code = 'EGP';
+UPDATE currencies SET aliases = '{"£","фунт","фунтов"}' WHERE code = 'GBP';
+UPDATE currencies SET aliases = '{"$","дол","долл","долларов","доллар","бакс","баксов"}' WHERE code = 'USD';
+UPDATE currencies SET aliases = '{"сумов"}' WHERE code = 'UZS';
+UPDATE currencies SET aliases = '{"бр"}' WHERE code = 'BYN';
+UPDATE currencies SET aliases = '{"манат"}' WHERE code = 'TMT';
+UPDATE currencies SET aliases = '{"дин","динар","динаров","din","рсд"}' WHERE code = 'RSD';
+UPDATE currencies SET aliases = '{"₼"}' WHERE code = 'AZN';
+UPDATE currencies SET aliases = '{"lei"}' WHERE code = 'RON';
+UPDATE currencies SET aliases = '{"₺","tl","лир","лира","лиры"}' WHERE code = 'TRY';
+UPDATE currencies SET aliases = '{"сдр"}' WHERE code = 'XDR';
+UPDATE currencies SET aliases = '{"сомони"}' WHERE code = 'TJS';
+UPDATE currencies SET aliases = '{"лв","левов"}' WHERE code = 'BGN';
+UPDATE currencies SET aliases = '{"€","евро"}' WHERE code = 'EUR';
+UPDATE currencies SET aliases = '{"₴","грн","гривен","гривна"}' WHERE code = 'UAH';
+UPDATE currencies SET aliases = '{"₾","лари"}' WHERE code = 'GEL';
+UPDATE currencies SET aliases = '{"zł","zl","злотый","злотых"}' WHERE code = 'PLN';
+UPDATE currencies SET aliases = '{"r$","реалов"}' WHERE code = 'BRL';
+
+COMMENT ON COLUMN currencies.aliases IS 'символы и названия валюты в сообщениях, кроме кода';
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- A manual amount typed as an expression like "120+80+45" is kept to show how the amount was counted.
+BEGIN;
+
+ALTER TABLE bills ADD COLUMN amount_expression varchar(255);
+
+COMMENT ON COLUMN bills.amount_expression IS 'выражение, из которого посчитана сумма, например 120+80+45';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- A multi-line message has a bill per line, so the message is linked to each of them by the line number.
+-- The messages saved before belong to single bills and get line 0.
+BEGIN;
+
+ALTER TABLE bill_messages ADD COLUMN line_no int not null default 0;
+ALTER TABLE bill_messages DROP CONSTRAINT bill_messages_pkey;
+ALTER TABLE bill_messages ADD PRIMARY KEY (chat_id, message_id, line_no);
+
+COMMENT ON COLUMN bill_messages.line_no IS 'номер строки в сообщении с несколькими тратами, 0 для одной траты';
+
+COMMIT;
@@ -0,0 +1,30 @@
+-- Only members can use the bot. The admins come from HOMEBUDGET_ADMINS and invite the others with one-time codes.
+BEGIN;
+
+CREATE TABLE members (
+  telegram_id bigint not null PRIMARY KEY,
+  is_admin boolean not null default false,
+  invited_by bigint,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+CREATE TABLE invites (
+  code varchar(64) not null PRIMARY KEY,
+  created_by bigint not null,
+  used_by bigint,
+  used_at timestamptz,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+COMMENT ON TABLE members IS 'пользователи telegram, которым разрешено пользоваться ботом';
+COMMENT ON COLUMN members.telegram_id IS 'id пользователя в telegram';
+COMMENT ON COLUMN members.is_admin IS 'может приглашать и удалять участников';
+COMMENT ON COLUMN members.invited_by IS 'telegram id пригласившего';
+
+COMMENT ON TABLE invites IS 'одноразовые приглашения';
+COMMENT ON COLUMN invites.code IS 'код приглашения';
+COMMENT ON COLUMN invites.created_by IS 'telegram id пригласившего';
+COMMENT ON COLUMN invites.used_by IS 'telegram id принявшего приглашение';
+COMMENT ON COLUMN invites.used_at IS 'когда приглашение принято';
+
+COMMIT;
@@ -0,0 +1,45 @@
+-- Users are looked up by their telegram id instead of user_name.
+-- Telegram ids were never stored before, the only trace of them is the chat id of the private chats
+-- in bill_messages, and those are kept only since 001_bill_messages. So most rows are left without telegram_id:
+-- such a row is claimed by user_name when its user writes to the bot next time, see getUserId.
+-- A row with an empty user_name may be shared by several people and is never claimed,
+-- its bills are moved to a ledger by 008_ledgers.
+BEGIN;
+
+ALTER TABLE users ADD COLUMN telegram_id bigint;
+
+-- a row without a user name may be shared by several people, such rows are skipped
+CREATE TEMPORARY TABLE user_chats ON COMMIT DROP AS
+SELECT b.user_id, min(m.chat_id) AS telegram_id
+FROM bill_messages m
+JOIN bills b ON b.id = m.bill_id
+WHERE m.chat_id > 0
+GROUP BY b.user_id
+HAVING count(DISTINCT m.chat_id) = 1;
+
+-- a person gets a new row after changing the telegram handle, the oldest one is kept
+CREATE TEMPORARY TABLE user_owners ON COMMIT DROP AS
+SELECT telegram_id, min(user_id) AS user_id
+FROM user_chats
+GROUP BY telegram_id;
+
+UPDATE bills b
+SET user_id = o.user_id
+FROM user_chats c
+JOIN user_owners o ON o.telegram_id = c.telegram_id
+WHERE b.user_id = c.user_id AND c.user_id <> o.user_id;
+
+DELETE FROM users u
+USING user_chats c
+JOIN user_owners o ON o.telegram_id = c.telegram_id
+WHERE u.id = c.user_id AND c.user_id <> o.user_id;
+
+UPDATE users u
+SET telegram_id = o.telegram_id
+FROM user_owners o
+WHERE u.id = o.user_id;
+
+CREATE UNIQUE INDEX idx_users_telegram_id ON users (telegram_id);
+COMMENT ON COLUMN users.telegram_id IS 'id пользователя в telegram';
+
+COMMIT;
@@ -0,0 +1,55 @@
+-- Bills belong to a ledger: a group chat has a shared one, a private chat with the bot a personal one.
+-- The chat of a bill is known if its messages are saved, the other bills go to the personal ledger of the user.
+-- Before ledgers every bill was seen by everybody, so the bills of users without telegram_id go to the group chat
+-- if the bot is in only one. Otherwise they wait for the user to write to the bot, see getUserId.
+BEGIN;
+
+CREATE SEQUENCE seq_ledger_id START 1;
+
+CREATE TABLE ledgers (
+  id BIGINT NOT NULL DEFAULT nextval('seq_ledger_id') PRIMARY KEY,
+  chat_id bigint not null,
+  title varchar(255) not null default '',
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_ledgers_chat ON ledgers (chat_id);
+
+ALTER TABLE bills ADD COLUMN ledger_id bigint;
+ALTER TABLE bills ADD CONSTRAINT fk_ledger_id FOREIGN KEY(ledger_id) REFERENCES ledgers(id);
+
+INSERT INTO ledgers(chat_id)
+SELECT DISTINCT chat_id FROM bill_messages;
+
+UPDATE bills b
+SET ledger_id = l.id
+FROM (SELECT DISTINCT ON (bill_id) bill_id, chat_id FROM bill_messages ORDER BY bill_id, created_at) m
+JOIN ledgers l ON l.chat_id = m.chat_id
+WHERE b.id = m.bill_id;
+
+-- in private chats the chat id is the telegram id of the user
+INSERT INTO ledgers(chat_id)
+SELECT DISTINCT u.telegram_id
+FROM bills b
+JOIN users u ON u.id = b.user_id
+WHERE b.ledger_id IS NULL AND u.telegram_id IS NOT NULL
+ON CONFLICT (chat_id) DO NOTHING;
+
+UPDATE bills b
+SET ledger_id = l.id
+FROM users u
+JOIN ledgers l ON l.chat_id = u.telegram_id
+WHERE b.user_id = u.id AND b.ledger_id IS NULL;
+
+UPDATE bills
+SET ledger_id = (SELECT id FROM ledgers WHERE chat_id < 0)
+WHERE ledger_id IS NULL AND (SELECT count(*) FROM ledgers WHERE chat_id < 0) = 1;
+
+CREATE INDEX idx_bills_ledger_date ON bills (ledger_id, bought_at);
+
+COMMENT ON TABLE ledgers IS 'бюджеты: общий для группового чата, личный для чата с ботом';
+COMMENT ON COLUMN ledgers.chat_id IS 'чат telegram';
+COMMENT ON COLUMN ledgers.title IS 'название чата или имя пользователя';
+COMMENT ON COLUMN bills.user_id IS 'кто платил';
+COMMENT ON COLUMN bills.ledger_id IS 'бюджет';
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Fiscal receipts are identified by the PFR invoice number, the same receipt can't be saved twice in a ledger.
+BEGIN;
+
+ALTER TABLE bills ADD COLUMN invoice_number varchar(64);
+ALTER TABLE bills ADD COLUMN invoice_counter varchar(64);
+CREATE UNIQUE INDEX idx_bills_ledger_invoice ON bills (ledger_id, invoice_number);
+
+COMMENT ON COLUMN bills.invoice_number IS 'ПФР број рачуна фискального чека';
+COMMENT ON COLUMN bills.invoice_counter IS 'бројач рачуна фискального чека';
+
+COMMIT;
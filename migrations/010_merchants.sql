@@ -0,0 +1,33 @@
+-- The shop of a fiscal receipt is saved as a merchant, the cashier and the payment method belong to the bill.
+BEGIN;
+
+CREATE SEQUENCE seq_merchant_id START 1;
+
+CREATE TABLE merchants (
+  id BIGINT NOT NULL DEFAULT nextval('seq_merchant_id') PRIMARY KEY,
+  pib varchar(20) not null,
+  name varchar(255) not null default '',
+  company varchar(255) not null default '',
+  address varchar(255) not null default '',
+  municipality varchar(255) not null default '',
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_merchants_pib_name ON merchants (pib, name);
+
+ALTER TABLE bills ADD COLUMN merchant_id bigint;
+ALTER TABLE bills ADD COLUMN cashier varchar(255);
+ALTER TABLE bills ADD COLUMN payment_method varchar(255);
+ALTER TABLE bills ADD CONSTRAINT fk_merchant_id FOREIGN KEY(merchant_id) REFERENCES merchants(id);
+CREATE INDEX idx_bills_merchant ON bills (merchant_id);
+
+COMMENT ON TABLE merchants IS 'точки продаж из фискальных чеков';
+COMMENT ON COLUMN merchants.pib IS 'ПИБ, налоговый номер предприятия';
+COMMENT ON COLUMN merchants.name IS 'место продаје, название магазина';
+COMMENT ON COLUMN merchants.company IS 'предузеће, название предприятия';
+COMMENT ON COLUMN merchants.address IS 'адрес';
+COMMENT ON COLUMN merchants.municipality IS 'община';
+COMMENT ON COLUMN bills.merchant_id IS 'магазин фискального чека';
+COMMENT ON COLUMN bills.cashier IS 'кассир';
+COMMENT ON COLUMN bills.payment_method IS 'способ оплаты: Готовина, Платна картица и другие';
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Categories of fiscal receipts by the merchant: by PIB or by a part of the shop or company name.
+BEGIN;
+
+CREATE SEQUENCE seq_merchant_category_id START 1;
+
+CREATE TABLE merchant_categories (
+  id BIGINT NOT NULL DEFAULT nextval('seq_merchant_category_id') PRIMARY KEY,
+  pib varchar(20),
+  name_pattern varchar(255),
+  category varchar(255) not null,
+  created_at timestamptz not null default CURRENT_TIMESTAMP,
+  CONSTRAINT chk_pib_or_name CHECK ((pib IS NULL) <> (name_pattern IS NULL))
+);
+CREATE UNIQUE INDEX idx_merchant_categories_pib ON merchant_categories (pib);
+CREATE UNIQUE INDEX idx_merchant_categories_name ON merchant_categories (name_pattern);
+
+COMMENT ON TABLE merchant_categories IS 'категории чеков по магазинам';
+COMMENT ON COLUMN merchant_categories.pib IS 'ПИБ предприятия, проверяется первым';
+COMMENT ON COLUMN merchant_categories.name_pattern IS 'часть названия магазина или предприятия в нижнем регистре';
+COMMENT ON COLUMN merchant_categories.category IS 'категория';
+
+COMMIT;
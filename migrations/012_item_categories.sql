@@ -0,0 +1,37 @@
+-- Receipt items get their own categories by the rules on the item name.
+-- Reports and exports take the amounts from bill_amounts: by items if any item has a category, otherwise the whole bill.
+BEGIN;
+
+ALTER TABLE bill_items ADD COLUMN category varchar(255);
+CREATE INDEX idx_bill_items_bill ON bill_items (bill_id);
+
+CREATE TABLE item_categories (
+  pattern varchar(255) not null PRIMARY KEY,
+  category varchar(255) not null,
+  created_at timestamptz not null default CURRENT_TIMESTAMP
+);
+
+CREATE VIEW bill_amounts AS
+SELECT b.id AS bill_id, COALESCE(i.category, b.category, '-') AS category, i.amount_rub, i.amount_usd
+FROM bills b
+JOIN bill_items i ON i.bill_id = b.id
+WHERE EXISTS (SELECT 1 FROM bill_items c WHERE c.bill_id = b.id AND c.category IS NOT NULL)
+UNION ALL
+SELECT b.id, COALESCE(b.category, '-'), b.amount_rub, b.amount_usd
+FROM bills b
+WHERE NOT EXISTS (SELECT 1 FROM bill_items c WHERE c.bill_id = b.id AND c.category IS NOT NULL);
+
+COMMENT ON COLUMN bill_items.category IS 'категория товара, если отличается от категории счета';
+COMMENT ON TABLE item_categories IS 'категории товаров в чеках';
+COMMENT ON COLUMN item_categories.pattern IS 'слово или регулярное выражение для названия товара, без учета регистра';
+COMMENT ON COLUMN item_categories.category IS 'категория';
+
+COMMENT ON VIEW bill_amounts IS 'суммы счетов по категориям: по товарам, если у товаров есть категории, иначе весь счет';
+
+insert into item_categories(pattern, category)
+values ('пиво|pivo|вино|vino|ракија|rakija|вотка|votka|виски|viski', 'Алкоголь'),
+       ('детерџент|deterdžent|омекшивач|omekšivač|прашак|prašak|тоалет папир|toalet papir', 'Дом и ремонт'),
+       ('шампон|šampon|паста за зубе|pasta za zube|сапун|sapun', 'Красота')
+;
+
+COMMIT;